@@ -0,0 +1,39 @@
+// Go で書いたマイグレーションを含めて goose を実行する
+// goose の CLI は Go のマイグレーションを実行できないため、代わりにこれを使う
+//
+//	go run ./cmd/migrate -dir ./sql/migrations DBSTRING COMMAND [ARGS...]
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"log"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pressly/goose/v3"
+	_ "github.com/yDog-1/wodun/backend/sql/migrations"
+)
+
+func main() {
+	dir := flag.String("dir", "./sql/migrations", "directory with migration files")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 2 {
+		log.Fatal("usage: migrate [-dir DIR] DBSTRING COMMAND [ARGS...]")
+	}
+	dbstring, command := args[0], args[1]
+
+	if err := goose.SetDialect(string(goose.DialectMySQL)); err != nil {
+		log.Fatalf("failed to set dialect: %v", err)
+	}
+	db, err := sql.Open("mysql", dbstring)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := goose.RunContext(context.Background(), command, db, *dir, args[2:]...); err != nil {
+		log.Fatalf("failed to run %s: %v", command, err)
+	}
+}
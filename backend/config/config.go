@@ -0,0 +1,361 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"gopkg.in/yaml.v3"
+)
+
+// 実行環境
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// SMS の送信方法
+const (
+	// 送信せずにログへ出力する。リンクのトークンがログに残るため、開発環境でのみ使える
+	SMSSenderLog = "log"
+)
+
+// アプリケーション全体の設定
+// 既定値、設定ファイル、環境変数の順に読み込み、後から読み込んだ値で上書きする
+type Config struct {
+	// EnvDevelopment か EnvProduction
+	Environment string      `yaml:"environment"`
+	Server      Server      `yaml:"server"`
+	MySQL       MySQL       `yaml:"mysql"`
+	Redis       Redis       `yaml:"redis"`
+	Token       Token       `yaml:"token"`
+	Mail        Mail        `yaml:"mail"`
+	SMS         SMS         `yaml:"sms"`
+	MagicLink   MagicLink   `yaml:"magicLink"`
+	EmailChange EmailChange `yaml:"emailChange"`
+	PhoneChange PhoneChange `yaml:"phoneChange"`
+	Google      Google      `yaml:"google"`
+	GraphQL     GraphQL     `yaml:"graphql"`
+}
+
+type Server struct {
+	Port string `yaml:"port"`
+	// 手前にあるリバースプロキシの数。X-Forwarded-For の右端からこの数だけ信頼する
+	// 0 の場合は X-Forwarded-For を使わない
+	TrustedProxies int `yaml:"trustedProxies"`
+}
+
+type MySQL struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+	Addr     string `yaml:"addr"`
+}
+
+type Redis struct {
+	Addr string `yaml:"addr"`
+}
+
+// トークンの発行と検証の設定
+type Token struct {
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// リフレッシュトークンの HS256 署名に使う共有鍵
+	RefreshSecret string `yaml:"refreshSecret"`
+	// アクセストークンの署名鍵を置くディレクトリ
+	KeysDir string `yaml:"keysDir"`
+	// 新しいトークンの署名に使う鍵のID
+	SigningKeyID string        `yaml:"signingKeyId"`
+	AccessTTL    time.Duration `yaml:"accessTtl"`
+	RefreshTTL   time.Duration `yaml:"refreshTtl"`
+	// nbf, iat, exp の検証で許容する時刻のずれ
+	ClockSkew time.Duration `yaml:"clockSkew"`
+}
+
+type Mail struct {
+	From string `yaml:"from"`
+	// SMTP を設定しない場合にメールを書き出すディレクトリ
+	Dir  string `yaml:"dir"`
+	SMTP SMTP   `yaml:"smtp"`
+}
+
+// Host が空の場合は SMTP で送信しない
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Sender が空の場合は SMS を送信せず、SMS でのログインと電話番号の変更を無効にする
+type SMS struct {
+	// 送信方法。SMSSenderLog のみ
+	Sender string `yaml:"sender"`
+}
+
+type MagicLink struct {
+	// マジックリンクの遷移先となるフロントエンドのログイン画面
+	URL string `yaml:"url"`
+}
+
+type EmailChange struct {
+	// メールアドレスの変更の確認リンクの遷移先となるフロントエンドの画面
+	URL string `yaml:"url"`
+}
+
+type PhoneChange struct {
+	// 電話番号の変更の確認リンクの遷移先となるフロントエンドの画面
+	URL string `yaml:"url"`
+}
+
+// ClientID が空の場合は Google ログインを無効にする
+type Google struct {
+	ClientID     string `yaml:"clientId"`
+	ClientSecret string `yaml:"clientSecret"`
+	RedirectURL  string `yaml:"redirectUrl"`
+}
+
+// GraphQL の問い合わせの量の制限
+type GraphQL struct {
+	// 問い合わせの入れ子の深さの上限
+	MaxDepth int `yaml:"maxDepth"`
+	// 1回の問い合わせの費用の上限
+	MaxComplexity int `yaml:"maxComplexity"`
+	// 呼び出し元ごとに CostWindow の間に使える費用の合計
+	CostBudget int           `yaml:"costBudget"`
+	CostWindow time.Duration `yaml:"costWindow"`
+}
+
+// 既定値の設定を返す
+func Default() Config {
+	return Config{
+		Environment: EnvProduction,
+		Server:      Server{Port: "8080"},
+		MySQL:       MySQL{Addr: "localhost:3306"},
+		Redis:       Redis{Addr: "localhost:6379"},
+		Token: Token{
+			KeysDir:    "keys",
+			AccessTTL:  time.Hour,
+			RefreshTTL: 7 * 24 * time.Hour,
+			ClockSkew:  30 * time.Second,
+		},
+		Mail: Mail{
+			From: "noreply@localhost",
+			Dir:  "tmp/mail",
+			SMTP: SMTP{Port: "587"},
+		},
+		MagicLink:   MagicLink{URL: "http://localhost:8000/login"},
+		EmailChange: EmailChange{URL: "http://localhost:8000/email/confirm"},
+		PhoneChange: PhoneChange{URL: "http://localhost:8000/phone/confirm"},
+		GraphQL: GraphQL{
+			MaxDepth:      10,
+			MaxComplexity: 2000,
+			CostBudget:    50000,
+			CostWindow:    time.Minute,
+		},
+	}
+}
+
+// 設定を読み込んで検証する
+// path が空の場合は設定ファイルを読まず、既定値と環境変数だけを使う
+func Load(path string) (*Config, error) {
+	return load(path, os.LookupEnv)
+}
+
+func load(path string, lookup func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		// 設定項目の綴り間違いに気づけるよう、未知のキーはエラーにする
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(lookup); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// 環境変数が設定されている項目を上書きする
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	strs := map[string]*string{
+		"APP_ENV":              &c.Environment,
+		"PORT":                 &c.Server.Port,
+		"MYSQL_USER":           &c.MySQL.User,
+		"MYSQL_PASSWORD":       &c.MySQL.Password,
+		"MYSQL_DATABASE":       &c.MySQL.Database,
+		"MYSQL_ADDR":           &c.MySQL.Addr,
+		"REDIS_ADDR":           &c.Redis.Addr,
+		"TOKEN_ISSUER":         &c.Token.Issuer,
+		"TOKEN_AUDIENCE":       &c.Token.Audience,
+		"TOKEN_REFRESH_SECRET": &c.Token.RefreshSecret,
+		"TOKEN_KEYS_DIR":       &c.Token.KeysDir,
+		"TOKEN_SIGNING_KEY_ID": &c.Token.SigningKeyID,
+		"MAIL_FROM":            &c.Mail.From,
+		"MAIL_DIR":             &c.Mail.Dir,
+		"SMTP_HOST":            &c.Mail.SMTP.Host,
+		"SMTP_PORT":            &c.Mail.SMTP.Port,
+		"SMTP_USERNAME":        &c.Mail.SMTP.Username,
+		"SMTP_PASSWORD":        &c.Mail.SMTP.Password,
+		"SMS_SENDER":           &c.SMS.Sender,
+		"MAGIC_LINK_URL":       &c.MagicLink.URL,
+		"EMAIL_CHANGE_URL":     &c.EmailChange.URL,
+		"PHONE_CHANGE_URL":     &c.PhoneChange.URL,
+		"GOOGLE_CLIENT_ID":     &c.Google.ClientID,
+		"GOOGLE_CLIENT_SECRET": &c.Google.ClientSecret,
+		"GOOGLE_REDIRECT_URL":  &c.Google.RedirectURL,
+	}
+	for key, p := range strs {
+		if v, ok := lookup(key); ok && v != "" {
+			*p = v
+		}
+	}
+
+	// エラーの順序が変わらないよう、期間の項目は順に処理する
+	durations := []struct {
+		key string
+		p   *time.Duration
+	}{
+		{"TOKEN_ACCESS_TTL", &c.Token.AccessTTL},
+		{"TOKEN_REFRESH_TTL", &c.Token.RefreshTTL},
+		{"TOKEN_CLOCK_SKEW", &c.Token.ClockSkew},
+		{"GRAPHQL_COST_WINDOW", &c.GraphQL.CostWindow},
+	}
+	var errs []error
+	for _, d := range durations {
+		v, ok := lookup(d.key)
+		if !ok || v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.key, err))
+			continue
+		}
+		*d.p = parsed
+	}
+
+	ints := []struct {
+		key string
+		p   *int
+	}{
+		{"TRUSTED_PROXIES", &c.Server.TrustedProxies},
+		{"GRAPHQL_MAX_DEPTH", &c.GraphQL.MaxDepth},
+		{"GRAPHQL_MAX_COMPLEXITY", &c.GraphQL.MaxComplexity},
+		{"GRAPHQL_COST_BUDGET", &c.GraphQL.CostBudget},
+	}
+	for _, n := range ints {
+		v, ok := lookup(n.key)
+		if !ok || v == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.key, err))
+			continue
+		}
+		*n.p = parsed
+	}
+	return errors.Join(errs...)
+}
+
+// 必須項目の有無と値の妥当性を確認する
+// 起動後に設定の誤りで失敗しないよう、全ての誤りをまとめて返す
+func (c *Config) Validate() error {
+	var errs []error
+	required := func(name, v string) {
+		if v == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+
+	if c.Environment != EnvDevelopment && c.Environment != EnvProduction {
+		errs = append(errs, fmt.Errorf("environment must be %q or %q: %q", EnvDevelopment, EnvProduction, c.Environment))
+	}
+	required("server.port", c.Server.Port)
+	if c.Server.TrustedProxies < 0 {
+		errs = append(errs, errors.New("server.trustedProxies must not be negative"))
+	}
+	required("mysql.user", c.MySQL.User)
+	required("mysql.database", c.MySQL.Database)
+	required("mysql.addr", c.MySQL.Addr)
+	required("redis.addr", c.Redis.Addr)
+
+	required("token.issuer", c.Token.Issuer)
+	required("token.audience", c.Token.Audience)
+	required("token.keysDir", c.Token.KeysDir)
+	required("token.signingKeyId", c.Token.SigningKeyID)
+	if n := len(c.Token.RefreshSecret); n < auth.MinRefreshSecretLength {
+		errs = append(errs, fmt.Errorf("token.refreshSecret must be at least %d bytes, got %d", auth.MinRefreshSecretLength, n))
+	}
+	if c.Token.AccessTTL <= 0 {
+		errs = append(errs, errors.New("token.accessTtl must be positive"))
+	}
+	if c.Token.RefreshTTL <= c.Token.AccessTTL {
+		errs = append(errs, errors.New("token.refreshTtl must be longer than token.accessTtl"))
+	}
+	if c.Token.ClockSkew < 0 {
+		errs = append(errs, errors.New("token.clockSkew must not be negative"))
+	}
+
+	required("mail.from", c.Mail.From)
+	if c.Mail.SMTP.Host == "" {
+		required("mail.dir", c.Mail.Dir)
+	} else {
+		required("mail.smtp.port", c.Mail.SMTP.Port)
+	}
+
+	switch c.SMS.Sender {
+	case "":
+	case SMSSenderLog:
+		if c.Environment != EnvDevelopment {
+			errs = append(errs, fmt.Errorf("sms.sender %q is only allowed in %s", SMSSenderLog, EnvDevelopment))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("sms.sender is unknown: %q", c.SMS.Sender))
+	}
+
+	absoluteURL := func(name, v string) {
+		if u, err := url.Parse(v); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s must be an absolute URL: %q", name, v))
+		}
+	}
+	absoluteURL("magicLink.url", c.MagicLink.URL)
+	absoluteURL("emailChange.url", c.EmailChange.URL)
+	absoluteURL("phoneChange.url", c.PhoneChange.URL)
+
+	if c.Google.ClientID != "" {
+		required("google.clientSecret", c.Google.ClientSecret)
+		required("google.redirectUrl", c.Google.RedirectURL)
+	}
+
+	if c.GraphQL.MaxDepth <= 0 {
+		errs = append(errs, errors.New("graphql.maxDepth must be positive"))
+	}
+	if c.GraphQL.MaxComplexity <= 0 {
+		errs = append(errs, errors.New("graphql.maxComplexity must be positive"))
+	}
+	// 予算が1回の上限より少ないと、上限以内の問い合わせが常に拒否される
+	if c.GraphQL.CostBudget < c.GraphQL.MaxComplexity {
+		errs = append(errs, errors.New("graphql.costBudget must be at least graphql.maxComplexity"))
+	}
+	if c.GraphQL.CostWindow < time.Millisecond {
+		errs = append(errs, errors.New("graphql.costWindow must be at least 1ms"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRefreshSecret = "0123456789abcdef0123456789abcdef"
+
+// 環境変数の代わりに map から値を引く
+func lookupMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+// 必須項目を全て満たす環境変数
+func requiredEnv() map[string]string {
+	return map[string]string{
+		"MYSQL_USER":           "wodun",
+		"MYSQL_DATABASE":       "wodun",
+		"TOKEN_ISSUER":         "https://wodun.example.com",
+		"TOKEN_AUDIENCE":       "wodun",
+		"TOKEN_REFRESH_SECRET": testRefreshSecret,
+		"TOKEN_SIGNING_KEY_ID": "2025-01",
+	}
+}
+
+func TestLoad_環境変数だけで読み込む(t *testing.T) {
+	env := requiredEnv()
+	env["PORT"] = "9000"
+	env["TOKEN_ACCESS_TTL"] = "15m"
+	env["TRUSTED_PROXIES"] = "1"
+
+	cfg, err := load("", lookupMap(env))
+	require.NoError(t, err)
+	assert.Equal(t, "9000", cfg.Server.Port)
+	assert.Equal(t, "wodun", cfg.MySQL.User)
+	assert.Equal(t, 15*time.Minute, cfg.Token.AccessTTL)
+	assert.Equal(t, 1, cfg.Server.TrustedProxies)
+	// 未設定の項目は既定値になる
+	assert.Equal(t, Default().Redis.Addr, cfg.Redis.Addr)
+	assert.Equal(t, Default().Token.RefreshTTL, cfg.Token.RefreshTTL)
+}
+
+func TestLoad_設定ファイルを環境変数で上書きする(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+server:
+  port: "9000"
+mysql:
+  user: file-user
+  database: wodun
+token:
+  issuer: https://wodun.example.com
+  audience: wodun
+  refreshSecret: `+testRefreshSecret+`
+  signingKeyId: "2025-01"
+  refreshTtl: 72h
+mail:
+  smtp:
+    host: smtp.example.com
+`), 0o600)
+	require.NoError(t, err)
+
+	cfg, err := load(path, lookupMap(map[string]string{"MYSQL_USER": "env-user"}))
+	require.NoError(t, err)
+	assert.Equal(t, "9000", cfg.Server.Port)
+	assert.Equal(t, "env-user", cfg.MySQL.User)
+	assert.Equal(t, 72*time.Hour, cfg.Token.RefreshTTL)
+	assert.Equal(t, "smtp.example.com", cfg.Mail.SMTP.Host)
+	assert.Equal(t, "587", cfg.Mail.SMTP.Port, "default should remain for unset nested field")
+}
+
+func TestLoad_未知のキーはエラー(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("token:\n  isuer: typo\n"), 0o600))
+
+	_, err := load(path, lookupMap(requiredEnv()))
+	assert.Error(t, err)
+}
+
+func TestLoad_不正な値をまとめて返す(t *testing.T) {
+	env := requiredEnv()
+	delete(env, "TOKEN_ISSUER")
+	env["TOKEN_REFRESH_SECRET"] = "short"
+	env["GOOGLE_CLIENT_ID"] = "client"
+	env["EMAIL_CHANGE_URL"] = "/email/confirm"
+
+	_, err := load("", lookupMap(env))
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "token.issuer is required")
+	assert.ErrorContains(t, err, "token.refreshSecret must be at least 32 bytes")
+	assert.ErrorContains(t, err, "google.clientSecret is required")
+	assert.ErrorContains(t, err, "emailChange.url must be an absolute URL")
+}
+
+func TestLoad_期間の形式が不正(t *testing.T) {
+	env := requiredEnv()
+	env["TOKEN_CLOCK_SKEW"] = "soon"
+
+	_, err := load("", lookupMap(env))
+	assert.ErrorContains(t, err, "TOKEN_CLOCK_SKEW")
+}
+
+func TestValidate_有効期限(t *testing.T) {
+	cfg, err := load("", lookupMap(requiredEnv()))
+	require.NoError(t, err)
+
+	cfg.Token.RefreshTTL = cfg.Token.AccessTTL
+	assert.ErrorContains(t, cfg.Validate(), "token.refreshTtl must be longer than token.accessTtl")
+}
+
+func TestLoad_GraphQLの制限を環境変数で上書きする(t *testing.T) {
+	env := requiredEnv()
+	env["GRAPHQL_MAX_DEPTH"] = "8"
+	env["GRAPHQL_COST_WINDOW"] = "30s"
+
+	cfg, err := load("", lookupMap(env))
+	require.NoError(t, err)
+	assert.Equal(t, 8, cfg.GraphQL.MaxDepth)
+	assert.Equal(t, 30*time.Second, cfg.GraphQL.CostWindow)
+	assert.Equal(t, Default().GraphQL.CostBudget, cfg.GraphQL.CostBudget)
+
+	env["GRAPHQL_COST_BUDGET"] = "many"
+	_, err = load("", lookupMap(env))
+	assert.ErrorContains(t, err, "GRAPHQL_COST_BUDGET")
+}
+
+func TestValidate_GraphQLの予算(t *testing.T) {
+	cfg, err := load("", lookupMap(requiredEnv()))
+	require.NoError(t, err)
+
+	cfg.GraphQL.CostBudget = cfg.GraphQL.MaxComplexity - 1
+	assert.ErrorContains(t, cfg.Validate(), "graphql.costBudget must be at least graphql.maxComplexity")
+}
+
+func TestValidate_SMSの送信方法(t *testing.T) {
+	cfg, err := load("", lookupMap(requiredEnv()))
+	require.NoError(t, err)
+	// 既定では SMS を送信しない
+	assert.Empty(t, cfg.SMS.Sender)
+
+	// リンクがログに残るため、本番環境ではログに出力できない
+	cfg.SMS.Sender = SMSSenderLog
+	assert.ErrorContains(t, cfg.Validate(), `sms.sender "log" is only allowed in development`)
+
+	cfg.Environment = EnvDevelopment
+	assert.NoError(t, cfg.Validate())
+
+	cfg.SMS.Sender = "twilio"
+	assert.ErrorContains(t, cfg.Validate(), "sms.sender is unknown")
+}
+
+func TestLoad_実行環境を環境変数で設定する(t *testing.T) {
+	env := requiredEnv()
+	env["APP_ENV"] = "development"
+	env["SMS_SENDER"] = "log"
+
+	cfg, err := load("", lookupMap(env))
+	require.NoError(t, err)
+	assert.Equal(t, EnvDevelopment, cfg.Environment)
+	assert.Equal(t, SMSSenderLog, cfg.SMS.Sender)
+
+	env["APP_ENV"] = "staging"
+	_, err = load("", lookupMap(env))
+	assert.ErrorContains(t, err, "environment must be")
+}
@@ -0,0 +1,34 @@
+// サービスとリポジトリの両方が扱うユーザーのエラーとIDの形式
+// リポジトリがサービスに依存しないよう、ここに置く
+package domain
+
+import (
+	"github.com/google/uuid"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+)
+
+var (
+	// ユーザーが存在しない
+	ErrUserNotFound = apperr.NotFound("user not found")
+	// 固有名が他のユーザーに使われている
+	ErrUniqueNameTaken = apperr.Conflict("uniqueName", "unique name is already taken")
+	// 固有名が他のユーザーの固有名と見た目で区別できない
+	ErrUniqueNameConfusable = apperr.Conflict("uniqueName", "unique name is too similar to an existing one")
+	// メールアドレスが他のユーザーに使われている
+	ErrEmailTaken = apperr.Conflict("email", "email is already taken")
+	// 電話番号が他のユーザーに使われている
+	ErrPhoneTaken = apperr.Conflict("phone", "phone number is already taken")
+	// 外部アカウントに紐づくユーザーが存在しない
+	ErrOIDCAccountNotFound = apperr.NotFound("no account is linked to the identity")
+)
+
+// ユーザーIDを検証し、小文字の UUID の形式にそろえる
+// ユーザーIDは公開用の UUIDv7 で、UUID として解釈できないIDのユーザーは存在しないため ErrUserNotFound を返す
+// 大文字などの表記の違うIDを、同じユーザーのIDとして比較するために使う
+func CanonicalUserID(id string) (string, error) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return "", ErrUserNotFound.Wrap(err)
+	}
+	return u.String(), nil
+}
@@ -4,9 +4,39 @@
 
 package dbstore
 
+import (
+	"database/sql"
+	"time"
+)
+
 type User struct {
-	ID          uint64
-	UniqueName  string
-	DisplayName string
-	Email       string
+	ID                 uint64
+	PublicID           string
+	UniqueName         string
+	DisplayName        string
+	Email              string
+	EmailVerified      bool
+	Phone              sql.NullString
+	Role               string
+	UniqueNameSkeleton string
+}
+
+type UserAuditLog struct {
+	ID        uint64
+	ActorID   uint64
+	UserID    uint64
+	Action    string
+	OldValue  string
+	NewValue  string
+	Reason    string
+	CreatedAt time.Time
+}
+
+type UserIdentity struct {
+	ID        uint64
+	UserID    uint64
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
 }
@@ -8,24 +8,33 @@ package dbstore
 import (
 	"context"
 	"database/sql"
+	"strings"
 )
 
 const createUser = `-- name: CreateUser :exec
 INSERT INTO users (
-	unique_name, display_name, email
+	public_id, unique_name, unique_name_skeleton, display_name, email
 ) VALUES (
-	?, ?, ?
+	?, ?, ?, ?, ?
 )
 `
 
 type CreateUserParams struct {
-	UniqueName  string
-	DisplayName string
-	Email       string
+	PublicID           string
+	UniqueName         string
+	UniqueNameSkeleton string
+	DisplayName        string
+	Email              string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) error {
-	_, err := q.db.ExecContext(ctx, createUser, arg.UniqueName, arg.DisplayName, arg.Email)
+	_, err := q.db.ExecContext(ctx, createUser,
+		arg.PublicID,
+		arg.UniqueName,
+		arg.UniqueNameSkeleton,
+		arg.DisplayName,
+		arg.Email,
+	)
 	return err
 }
 
@@ -42,9 +51,14 @@ func (q *Queries) DeleteUser(ctx context.Context, uniqueName string) error {
 const getUser = `-- name: GetUser :one
 SELECT
 	id,
+	public_id,
 	unique_name,
 	display_name,
-	email
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
 FROM users
 WHERE unique_name = ?
 `
@@ -54,25 +68,228 @@ func (q *Queries) GetUser(ctx context.Context, uniqueName string) (User, error)
 	var i User
 	err := row.Scan(
 		&i.ID,
+		&i.PublicID,
+		&i.UniqueName,
+		&i.DisplayName,
+		&i.Email,
+		&i.EmailVerified,
+		&i.Phone,
+		&i.Role,
+		&i.UniqueNameSkeleton,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT
+	id,
+	public_id,
+	unique_name,
+	display_name,
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
+FROM users
+WHERE email = ?
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.UniqueName,
+		&i.DisplayName,
+		&i.Email,
+		&i.EmailVerified,
+		&i.Phone,
+		&i.Role,
+		&i.UniqueNameSkeleton,
+	)
+	return i, err
+}
+
+const getUserByPhone = `-- name: GetUserByPhone :one
+SELECT
+	id,
+	public_id,
+	unique_name,
+	display_name,
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
+FROM users
+WHERE phone = ?
+`
+
+func (q *Queries) GetUserByPhone(ctx context.Context, phone sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByPhone, phone)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.UniqueName,
+		&i.DisplayName,
+		&i.Email,
+		&i.EmailVerified,
+		&i.Phone,
+		&i.Role,
+		&i.UniqueNameSkeleton,
+	)
+	return i, err
+}
+
+const getUserByPublicID = `-- name: GetUserByPublicID :one
+SELECT
+	id,
+	public_id,
+	unique_name,
+	display_name,
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
+FROM users
+WHERE public_id = ?
+`
+
+func (q *Queries) GetUserByPublicID(ctx context.Context, publicID string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByPublicID, publicID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
 		&i.UniqueName,
 		&i.DisplayName,
 		&i.Email,
+		&i.EmailVerified,
+		&i.Phone,
+		&i.Role,
+		&i.UniqueNameSkeleton,
 	)
 	return i, err
 }
 
+const getUserByUniqueNameSkeleton = `-- name: GetUserByUniqueNameSkeleton :one
+SELECT
+	id,
+	public_id,
+	unique_name,
+	display_name,
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
+FROM users
+WHERE unique_name_skeleton = ?
+`
+
+func (q *Queries) GetUserByUniqueNameSkeleton(ctx context.Context, uniqueNameSkeleton string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByUniqueNameSkeleton, uniqueNameSkeleton)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.UniqueName,
+		&i.DisplayName,
+		&i.Email,
+		&i.EmailVerified,
+		&i.Phone,
+		&i.Role,
+		&i.UniqueNameSkeleton,
+	)
+	return i, err
+}
+
+const getUsersByPublicIDs = `-- name: GetUsersByPublicIDs :many
+SELECT
+	id,
+	public_id,
+	unique_name,
+	display_name,
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
+FROM users
+WHERE public_id IN (/*SLICE:public_ids*/?)
+`
+
+func (q *Queries) GetUsersByPublicIDs(ctx context.Context, publicIDs []string) ([]User, error) {
+	query := getUsersByPublicIDs
+	var queryParams []interface{}
+	if len(publicIDs) > 0 {
+		for _, v := range publicIDs {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:public_ids*/?", strings.Repeat(",?", len(publicIDs))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:public_ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.PublicID,
+			&i.UniqueName,
+			&i.DisplayName,
+			&i.Email,
+			&i.EmailVerified,
+			&i.Phone,
+			&i.Role,
+			&i.UniqueNameSkeleton,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUsers = `-- name: ListUsers :many
 SELECT
 	id,
+	public_id,
 	unique_name,
 	display_name,
-	email
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
 FROM users
-ORDER BY id
+WHERE public_id > ?
+ORDER BY public_id
+LIMIT ?
 `
 
-func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
-	rows, err := q.db.QueryContext(ctx, listUsers)
+type ListUsersParams struct {
+	After string
+	Limit int32
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers, arg.After, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -82,9 +299,14 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 		var i User
 		if err := rows.Scan(
 			&i.ID,
+			&i.PublicID,
 			&i.UniqueName,
 			&i.DisplayName,
 			&i.Email,
+			&i.EmailVerified,
+			&i.Phone,
+			&i.Role,
+			&i.UniqueNameSkeleton,
 		); err != nil {
 			return nil, err
 		}
@@ -99,28 +321,101 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 	return items, nil
 }
 
-const updateUser = `-- name: UpdateUser :exec
+const renameUser = `-- name: RenameUser :exec
 UPDATE users
 SET
-	unique_name = COALESCE(?, unique_name),
-	display_name = COALESCE(?, display_name),
-	email = COALESCE(?, email)
+	unique_name = ?,
+	unique_name_skeleton = ?
 WHERE id = ?
 `
 
+type RenameUserParams struct {
+	UniqueName         string
+	UniqueNameSkeleton string
+	ID                 uint64
+}
+
+func (q *Queries) RenameUser(ctx context.Context, arg RenameUserParams) error {
+	_, err := q.db.ExecContext(ctx, renameUser, arg.UniqueName, arg.UniqueNameSkeleton, arg.ID)
+	return err
+}
+
+const updateUser = `-- name: UpdateUser :exec
+UPDATE users
+SET display_name = COALESCE(?, display_name)
+WHERE public_id = ?
+`
+
 type UpdateUserParams struct {
-	UniqueName  sql.NullString
 	DisplayName sql.NullString
-	Email       sql.NullString
-	ID          uint64
+	PublicID    string
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
-	_, err := q.db.ExecContext(ctx, updateUser,
-		arg.UniqueName,
-		arg.DisplayName,
-		arg.Email,
-		arg.ID,
-	)
+	_, err := q.db.ExecContext(ctx, updateUser, arg.DisplayName, arg.PublicID)
+	return err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :exec
+UPDATE users
+SET email = ?, email_verified = TRUE
+WHERE public_id = ?
+`
+
+type UpdateUserEmailParams struct {
+	Email    string
+	PublicID string
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserEmail, arg.Email, arg.PublicID)
+	return err
+}
+
+const updateUserPhone = `-- name: UpdateUserPhone :exec
+UPDATE users
+SET phone = ?
+WHERE public_id = ?
+`
+
+type UpdateUserPhoneParams struct {
+	Phone    sql.NullString
+	PublicID string
+}
+
+func (q *Queries) UpdateUserPhone(ctx context.Context, arg UpdateUserPhoneParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPhone, arg.Phone, arg.PublicID)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :exec
+UPDATE users
+SET role = ?
+WHERE public_id = ?
+`
+
+type UpdateUserRoleParams struct {
+	Role     string
+	PublicID string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserRole, arg.Role, arg.PublicID)
+	return err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :exec
+UPDATE users
+SET email_verified = TRUE
+WHERE public_id = ? AND email = ?
+`
+
+type VerifyUserEmailParams struct {
+	PublicID string
+	Email    string
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) error {
+	_, err := q.db.ExecContext(ctx, verifyUserEmail, arg.PublicID, arg.Email)
 	return err
 }
@@ -0,0 +1,155 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/ratelimit"
+	"github.com/yDog-1/wodun/backend/service"
+)
+
+// 実行可能なスキーマの設定を組み立てる
+func NewConfig(r *Resolver) Config {
+	// nil のポインタをインターフェースに入れると nil と判定できなくなるため、明示的に分ける
+	var limiter rateLimiter
+	if r.RateLimiter != nil {
+		limiter = r.RateLimiter
+	}
+	cfg := Config{
+		Resolvers: r,
+		Directives: DirectiveRoot{
+			Auth:      Auth,
+			HasRole:   HasRole,
+			Private:   Private,
+			RateLimit: RateLimit(limiter),
+		},
+	}
+	setComplexity(&cfg.Complexity)
+	return cfg
+}
+
+// @auth の実装
+// ログインしていない呼び出し元を拒否する
+func Auth(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
+	if _, ok := auth.PrincipalFrom(ctx); !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	return next(ctx)
+}
+
+// @hasRole の実装
+// 指定した権限以上を持たない呼び出し元を拒否する
+func HasRole(ctx context.Context, obj any, next graphql.Resolver, role auth.Role) (any, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	if !p.Role.Includes(role) {
+		return nil, errForbidden
+	}
+	return next(ctx)
+}
+
+// 非公開の項目を持つオブジェクト
+type owned interface {
+	// 非公開の項目を閲覧できる本人のID
+	OwnerID() string
+}
+
+// @private の実装
+// 本人と role 以上の権限を持つ呼び出し元以外には、エラーにせず null を返す
+func Private(ctx context.Context, obj any, next graphql.Resolver, role auth.Role) (any, error) {
+	o, ok := obj.(owned)
+	if !ok {
+		return nil, fmt.Errorf("@private requires the parent object to implement OwnerID, got %T", obj)
+	}
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok || (p.UserID != o.OwnerID() && !p.Role.Includes(role)) {
+		return nil, nil
+	}
+	return next(ctx)
+}
+
+type rateLimiter interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (ratelimit.Result, error)
+}
+
+// @rateLimit の実装
+// フィールドと key の値ごとに呼び出し回数を数え、上限を超えた呼び出しを拒否する
+// limiter が nil の場合は制限しない
+func RateLimit(limiter rateLimiter) func(ctx context.Context, obj any, next graphql.Resolver, limit int32, window string, key model.RateLimitKey) (any, error) {
+	return func(ctx context.Context, obj any, next graphql.Resolver, limit int32, window string, key model.RateLimitKey) (any, error) {
+		if limiter == nil {
+			return next(ctx)
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit window %q: %w", window, err)
+		}
+		value, err := rateLimitValue(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		fc := graphql.GetFieldContext(ctx)
+		k := fmt.Sprintf("%s.%s:%s:%s", fc.Object, fc.Field.Name, strings.ToLower(key.String()), value)
+		res, err := limiter.Allow(ctx, k, int(limit), d)
+		if err != nil {
+			return nil, err
+		}
+		if !res.Allowed {
+			return nil, apperr.RateLimited(res.RetryAfter)
+		}
+		return next(ctx)
+	}
+}
+
+// 流量を数える単位の値を取り出す
+func rateLimitValue(ctx context.Context, key model.RateLimitKey) (string, error) {
+	switch key {
+	case model.RateLimitKeyIP:
+		ip, ok := ratelimit.ClientIPFrom(ctx)
+		if !ok {
+			return "", fmt.Errorf("client ip is not set")
+		}
+		return ip, nil
+	case model.RateLimitKeyUser:
+		p, ok := auth.PrincipalFrom(ctx)
+		if !ok {
+			return "", auth.ErrUnauthenticated
+		}
+		return p.UserID, nil
+	case model.RateLimitKeyEmail:
+		email, err := stringArg(ctx, "email")
+		if err != nil {
+			return "", err
+		}
+		// 表記の揺れで制限を回避できないよう、大文字小文字と前後の空白を揃える
+		return strings.ToLower(strings.TrimSpace(email)), nil
+	case model.RateLimitKeyPhone:
+		phone, err := stringArg(ctx, "phone")
+		if err != nil {
+			return "", err
+		}
+		// 表記の揺れで制限を回避できないよう、E.164 形式に揃える
+		if normalized, err := service.NormalizePhoneNumber(phone); err == nil {
+			return normalized, nil
+		}
+		return phone, nil
+	}
+	return "", fmt.Errorf("unknown rate limit key %q", key)
+}
+
+// フィールドの文字列の引数を取り出す
+func stringArg(ctx context.Context, name string) (string, error) {
+	v, ok := graphql.GetFieldContext(ctx).Args[name].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %q is not a string", name)
+	}
+	return v, nil
+}
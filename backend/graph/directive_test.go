@@ -0,0 +1,230 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/ratelimit"
+)
+
+// 依存関係を持たない Resolver でテスト用のクライアントを生成する
+// ディレクティブで拒否される操作はリゾルバーまで到達しない
+func newTestClient(r *Resolver) *client.Client {
+	return newTestClientWithConfig(NewConfig(r))
+}
+
+// エラーの変換をサーバーと揃えたクライアントを作る
+func newTestClientWithConfig(cfg Config) *client.Client {
+	srv := handler.New(NewExecutableSchema(cfg))
+	srv.AddTransport(transport.POST{})
+	srv.SetErrorPresenter(ErrorPresenter)
+	srv.SetRecoverFunc(Recover)
+	return client.New(srv)
+}
+
+// 呼び出し元を context に設定するオプション
+func withPrincipal(p *auth.Principal) client.Option {
+	return func(bd *client.Request) {
+		bd.HTTP = bd.HTTP.WithContext(auth.WithPrincipal(bd.HTTP.Context(), p))
+	}
+}
+
+var updateUserMutation = fmt.Sprintf(`mutation {
+	updateUser(id: %[1]q, input: {displayName: "modified"})
+}`, toGlobalID("User", "1"))
+
+func TestAuthDirective_未認証の呼び出しを拒否する(t *testing.T) {
+	c := newTestClient(&Resolver{})
+
+	var resp map[string]any
+	err := c.Post(updateUserMutation, &resp)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), auth.ErrUnauthenticated.Error())
+}
+
+func TestUpdateUser_他人のユーザー情報は更新できない(t *testing.T) {
+	c := newTestClient(&Resolver{})
+
+	var resp map[string]any
+	err := c.Post(updateUserMutation, &resp, withPrincipal(&auth.Principal{UserID: "2"}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), errForbidden.Error())
+}
+
+// 本人確認をリゾルバーだけに頼らないよう、スキーマでも認証を求める
+func TestSchema_updateUserは認証を求める(t *testing.T) {
+	schema := NewExecutableSchema(NewConfig(&Resolver{})).Schema()
+	f := schema.Mutation.Fields.ForName("updateUser")
+	require.NotNil(t, f)
+	assert.NotNil(t, f.Directives.ForName("auth"))
+}
+
+func TestUpdateUser_固有名は入力に含められない(t *testing.T) {
+	c := newTestClient(&Resolver{})
+
+	var resp map[string]any
+	mutation := fmt.Sprintf(`mutation {
+		updateUser(id: %[1]q, input: {uniqueName: "modified"})
+	}`, toGlobalID("User", "1"))
+	err := c.Post(mutation, &resp, withPrincipal(&auth.Principal{UserID: "1"}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "GRAPHQL_VALIDATION_FAILED")
+}
+
+func TestAuth(t *testing.T) {
+	next := func(ctx context.Context) (any, error) { return true, nil }
+
+	_, err := Auth(context.Background(), nil, next)
+	assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{UserID: "1"})
+	res, err := Auth(ctx, nil, next)
+	require.NoError(t, err)
+	assert.Equal(t, true, res)
+}
+
+func TestHasRole(t *testing.T) {
+	next := func(ctx context.Context) (any, error) { return true, nil }
+
+	_, err := HasRole(context.Background(), nil, next, auth.RoleAdmin)
+	assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+
+	member := auth.WithPrincipal(context.Background(), &auth.Principal{UserID: "1", Role: auth.RoleMember})
+	_, err = HasRole(member, nil, next, auth.RoleModerator)
+	assert.ErrorIs(t, err, errForbidden)
+
+	admin := auth.WithPrincipal(context.Background(), &auth.Principal{UserID: "1", Role: auth.RoleAdmin})
+	res, err := HasRole(admin, nil, next, auth.RoleModerator)
+	require.NoError(t, err)
+	assert.Equal(t, true, res)
+}
+
+func TestPrivate(t *testing.T) {
+	next := func(ctx context.Context) (any, error) { return "a@example.com", nil }
+	owner := &model.User{ID: "1"}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		want      any
+	}{
+		{name: "未認証", want: nil},
+		{name: "他人", principal: &auth.Principal{UserID: "2", Role: auth.RoleMember}, want: nil},
+		{name: "本人", principal: &auth.Principal{UserID: "1", Role: auth.RoleMember}, want: "a@example.com"},
+		{name: "モデレーター", principal: &auth.Principal{UserID: "2", Role: auth.RoleModerator}, want: "a@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = auth.WithPrincipal(ctx, tt.principal)
+			}
+			res, err := Private(ctx, owner, next, auth.RoleModerator)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, res)
+		})
+	}
+
+	_, err := Private(context.Background(), struct{}{}, next, auth.RoleModerator)
+	assert.Error(t, err)
+}
+
+func TestSetUserRole_管理者以外は実行できない(t *testing.T) {
+	c := newTestClient(&Resolver{})
+
+	var resp map[string]any
+	mutation := `mutation { setUserRole(id: "2", role: ADMIN) }`
+	err := c.Post(mutation, &resp, withPrincipal(&auth.Principal{UserID: "1", Role: auth.RoleModerator}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), errForbidden.Error())
+}
+
+func TestRenameUser_管理者以外は実行できない(t *testing.T) {
+	c := newTestClient(&Resolver{})
+
+	var resp map[string]any
+	mutation := `mutation { renameUser(id: "2", uniqueName: "renamed", reason: "test") { id } }`
+	err := c.Post(mutation, &resp, withPrincipal(&auth.Principal{UserID: "1", Role: auth.RoleModerator}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), errForbidden.Error())
+}
+
+// 呼び出されたキーを記録し、常に拒否する rateLimiter
+type denyingLimiter struct {
+	keys []string
+}
+
+func (l *denyingLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (ratelimit.Result, error) {
+	l.keys = append(l.keys, key)
+	return ratelimit.Result{Allowed: false, RetryAfter: 1500 * time.Millisecond}, nil
+}
+
+func TestRateLimit_上限を超えた呼び出しを拒否する(t *testing.T) {
+	limiter := &denyingLimiter{}
+	cfg := NewConfig(&Resolver{})
+	cfg.Directives.RateLimit = RateLimit(limiter)
+	c := newTestClientWithConfig(cfg)
+
+	var resp map[string]any
+	err := c.Post(`mutation { sendMagicLink(email: " User@Example.com ") }`, &resp, func(bd *client.Request) {
+		bd.HTTP = bd.HTTP.WithContext(ratelimit.WithClientIP(bd.HTTP.Context(), "192.0.2.1"))
+	})
+	require.Error(t, err)
+
+	// 外側の IP の制限で拒否され、内側のメールアドレスの制限までは進まない
+	assert.Equal(t, []string{"Mutation.sendMagicLink:ip:192.0.2.1"}, limiter.keys)
+
+	var gqlErrs gqlerror.List
+	require.NoError(t, json.Unmarshal([]byte(err.Error()), &gqlErrs))
+	require.Len(t, gqlErrs, 1)
+	assert.Equal(t, "RATE_LIMITED", gqlErrs[0].Extensions["code"])
+	assert.EqualValues(t, 2, gqlErrs[0].Extensions["retryAfter"])
+}
+
+func TestRateLimitValue(t *testing.T) {
+	ctx := graphql.WithFieldContext(context.Background(), &graphql.FieldContext{
+		Args: map[string]any{"email": " User@Example.com ", "phone": "090-1234-5678"},
+	})
+	ctx = auth.WithPrincipal(ctx, &auth.Principal{UserID: "1"})
+
+	v, err := rateLimitValue(ctx, model.RateLimitKeyEmail)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", v)
+
+	v, err = rateLimitValue(ctx, model.RateLimitKeyPhone)
+	require.NoError(t, err)
+	assert.Equal(t, "+819012345678", v)
+
+	v, err = rateLimitValue(ctx, model.RateLimitKeyUser)
+	require.NoError(t, err)
+	assert.Equal(t, "1", v)
+
+	_, err = rateLimitValue(context.Background(), model.RateLimitKeyUser)
+	assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+}
+
+// スキーマに書いた @rateLimit の window が全て解釈できることを確認する
+func TestSchema_rateLimitのwindow(t *testing.T) {
+	schema := NewExecutableSchema(NewConfig(&Resolver{})).Schema()
+	for _, typ := range schema.Types {
+		for _, f := range typ.Fields {
+			for _, d := range f.Directives.ForNames("rateLimit") {
+				window := d.Arguments.ForName("window").Value.Raw
+				_, err := time.ParseDuration(window)
+				assert.NoError(t, err, "%s.%s", typ.Name, f.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"runtime/debug"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+)
+
+var (
+	// Google ログインが設定されていない
+	errGoogleLoginDisabled = apperr.Forbidden("google login is not configured")
+	// 呼び出し元に操作の権限がない
+	errForbidden = apperr.Forbidden("forbidden")
+)
+
+// resolver やディレクティブが返したエラーを、クライアントに返す形式に変換する
+// extensions.code にエラーの種類を設定し、理由があれば extensions.reason に設定する
+// apperr.Error 以外のエラーは予期しないエラーとしてログに残し、内容を伏せて返す
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	presented := *graphql.DefaultErrorPresenter(ctx, err)
+	// 引数の変換の誤りなど、gqlgen が作ったエラーはクライアント向けのメッセージを持つ
+	if gqlErr, ok := err.(*gqlerror.Error); ok && gqlErr.Err == nil {
+		if _, ok := gqlErr.Extensions["code"]; !ok {
+			presented.Extensions = map[string]any{"code": string(apperr.CodeValidation)}
+		}
+		return &presented
+	}
+
+	var e *apperr.Error
+	if !errors.As(err, &e) {
+		e = apperr.Internal(err)
+	}
+	if e.Code == apperr.CodeInternal {
+		log.Printf("internal error at %s: %v", presented.Path, err)
+	}
+
+	presented.Message = e.Message
+	ext := map[string]any{"code": string(e.Code)}
+	switch e.Code {
+	case apperr.CodeValidation:
+		fields := make([]map[string]any, len(e.Fields))
+		for i, f := range e.Fields {
+			fields[i] = map[string]any{"path": f.Path, "message": f.Message}
+		}
+		ext["fields"] = fields
+	case apperr.CodeConflict:
+		ext["field"] = e.Field
+	case apperr.CodeRateLimited:
+		// 再試行できるまでの秒数を切り上げて返す
+		ext["retryAfter"] = int(math.Ceil(e.RetryAfter.Seconds()))
+		if e.Amount > 0 {
+			ext["cost"] = e.Amount
+			ext["remainingBudget"] = e.Limit
+		}
+	case apperr.CodeQueryTooDeep:
+		ext["depth"] = e.Amount
+		ext["maxDepth"] = e.Limit
+	case apperr.CodeQueryTooComplex:
+		ext["cost"] = e.Amount
+		ext["maxCost"] = e.Limit
+	}
+	if e.Reason != "" {
+		ext["reason"] = e.Reason
+	}
+	presented.Extensions = ext
+	return &presented
+}
+
+// resolver の panic をスタックトレースとともにログに残し、予期しないエラーとして返す
+func Recover(ctx context.Context, v any) error {
+	log.Printf("panic: %v\n%s", v, debug.Stack())
+	return apperr.Internal(fmt.Errorf("panic: %v", v))
+}
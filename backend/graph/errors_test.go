@@ -0,0 +1,120 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+)
+
+func TestErrorPresenter(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		message    string
+		extensions map[string]any
+	}{
+		{
+			name:       "見つからない",
+			err:        domain.ErrUserNotFound.Wrap(sql.ErrNoRows),
+			message:    "user not found",
+			extensions: map[string]any{"code": "NOT_FOUND"},
+		},
+		{
+			name:       "衝突した項目を返す",
+			err:        domain.ErrEmailTaken,
+			message:    "email is already taken",
+			extensions: map[string]any{"code": "CONFLICT", "field": "email"},
+		},
+		{
+			name:    "入力の誤りを項目ごとに返す",
+			err:     apperr.Validation(apperr.Field("input.uniqueName", "too short"), apperr.Field("input.email", "invalid")),
+			message: "input.uniqueName: too short; input.email: invalid",
+			extensions: map[string]any{
+				"code": "VALIDATION_FAILED",
+				"fields": []map[string]any{
+					{"path": "input.uniqueName", "message": "too short"},
+					{"path": "input.email", "message": "invalid"},
+				},
+			},
+		},
+		{
+			name:       "期限切れのトークンは理由を返す",
+			err:        fmt.Errorf("%w: %w", auth.ErrTokenExpired, errors.New("token is expired")),
+			message:    "token expired",
+			extensions: map[string]any{"code": "UNAUTHENTICATED", "reason": "TOKEN_EXPIRED"},
+		},
+		{
+			name:       "ラップされたトークンのエラー",
+			err:        auth.ErrTokenRevoked,
+			message:    "invalid token",
+			extensions: map[string]any{"code": "UNAUTHENTICATED"},
+		},
+		{
+			name:       "再試行できるまでの秒数を切り上げる",
+			err:        apperr.RateLimited(1500 * time.Millisecond),
+			message:    "rate limit exceeded",
+			extensions: map[string]any{"code": "RATE_LIMITED", "retryAfter": 2},
+		},
+		{
+			name:       "予期しないエラーは内容を伏せる",
+			err:        fmt.Errorf("failed to connect to 10.0.0.1:3306: %w", sql.ErrConnDone),
+			message:    "internal server error",
+			extensions: map[string]any{"code": "INTERNAL"},
+		},
+		{
+			name:       "gqlgen が作ったエラーはメッセージを残す",
+			err:        gqlerror.Errorf("must be defined"),
+			message:    "must be defined",
+			extensions: map[string]any{"code": "VALIDATION_FAILED"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ErrorPresenter(context.Background(), tt.err)
+			assert.Equal(t, tt.message, got.Message)
+			assert.Equal(t, tt.extensions, got.Extensions)
+		})
+	}
+}
+
+func TestRecover_panicの内容を返さない(t *testing.T) {
+	// UserService が未設定のため resolver が panic する
+	c := newTestClient(&Resolver{})
+
+	var resp map[string]any
+	err := c.Post(`query($id: ID!) { user(id: $id) { id } }`, &resp, client.Var("id", toGlobalID("User", "1")))
+	require.Error(t, err)
+
+	var gqlErrs gqlerror.List
+	require.NoError(t, json.Unmarshal([]byte(err.Error()), &gqlErrs))
+	require.Len(t, gqlErrs, 1)
+	assert.Equal(t, "internal server error", gqlErrs[0].Message)
+	assert.Equal(t, "INTERNAL", gqlErrs[0].Extensions["code"])
+	assert.Equal(t, "user", gqlErrs[0].Path.String())
+}
+
+func TestUsers_範囲外のfirstを拒否する(t *testing.T) {
+	c := newTestClient(&Resolver{})
+
+	var resp map[string]any
+	err := c.Post(`query { users(first: 101) { edges { cursor } } }`, &resp, withPrincipal(&auth.Principal{UserID: "1"}))
+	require.Error(t, err)
+
+	var gqlErrs gqlerror.List
+	require.NoError(t, json.Unmarshal([]byte(err.Error()), &gqlErrs))
+	require.Len(t, gqlErrs, 1)
+	assert.Equal(t, "VALIDATION_FAILED", gqlErrs[0].Extensions["code"])
+	assert.Equal(t, []any{map[string]any{"path": "first", "message": "must be between 0 and 100"}}, gqlErrs[0].Extensions["fields"])
+}
@@ -0,0 +1,164 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/pagination"
+	"github.com/yDog-1/wodun/backend/pkg/ratelimit"
+)
+
+// 件数を制限しない一覧の費用を見積もるときの件数
+const unboundedListSize = 50
+
+// フィールドごとの費用を設定する
+// 一覧を返すフィールドは、子の費用に返す件数を掛ける
+func setComplexity(c *ComplexityRoot) {
+	c.Query.Users = func(childComplexity int, first *int32, after *string) int {
+		n := pagination.DefaultFirst
+		if first != nil {
+			n = int(*first)
+		}
+		return listComplexity(childComplexity, n)
+	}
+	c.Query.Nodes = func(childComplexity int, ids []string) int {
+		return listComplexity(childComplexity, len(ids))
+	}
+	c.Query.Sessions = func(childComplexity int) int {
+		return listComplexity(childComplexity, unboundedListSize)
+	}
+	c.Query.UserAuditLogs = func(childComplexity int, userID string) int {
+		return listComplexity(childComplexity, unboundedListSize)
+	}
+}
+
+// n 件の一覧の費用
+// 費用の上限を回避できないよう、桁あふれする場合は int の最大値にする
+func listComplexity(childComplexity, n int) int {
+	if n < 0 {
+		n = 0
+	}
+	if n > 0 && childComplexity > (math.MaxInt-1)/n {
+		return math.MaxInt
+	}
+	return 1 + childComplexity*n
+}
+
+type costLimiter interface {
+	Spend(ctx context.Context, key string, cost, budget int, window time.Duration) (ratelimit.Result, error)
+}
+
+// 問い合わせの深さと費用を実行前に確かめ、上限を超えた問い合わせを拒否する
+// 費用は gqlgen の complexity で計算し、呼び出し元ごとの予算から差し引く
+type QueryLimit struct {
+	MaxDepth      int
+	MaxComplexity int
+	// 呼び出し元ごとに Window の間に使える費用の合計
+	Budget int
+	Window time.Duration
+	// nil の場合は予算を数えない
+	Limiter costLimiter
+
+	es graphql.ExecutableSchema
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = &QueryLimit{}
+
+func (QueryLimit) ExtensionName() string {
+	return "QueryLimit"
+}
+
+func (l *QueryLimit) Validate(schema graphql.ExecutableSchema) error {
+	if l.MaxDepth <= 0 || l.MaxComplexity <= 0 {
+		return errors.New("QueryLimit requires positive MaxDepth and MaxComplexity")
+	}
+	if l.Limiter != nil && (l.Budget <= 0 || l.Window <= 0) {
+		return errors.New("QueryLimit requires positive Budget and Window when Limiter is set")
+	}
+	l.es = schema
+	return nil
+}
+
+func (l *QueryLimit) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	op := opCtx.Doc.Operations.ForName(opCtx.OperationName)
+	if op == nil {
+		// 操作が見つからない誤りは、実行時に gqlgen が返す
+		return nil
+	}
+	if depth := selectionDepth(op.SelectionSet); depth > l.MaxDepth {
+		return limitError(apperr.QueryTooDeep(depth, l.MaxDepth))
+	}
+	cost := complexity.Calculate(l.es, op, opCtx.Variables)
+	if cost > l.MaxComplexity {
+		return limitError(apperr.QueryTooComplex(cost, l.MaxComplexity))
+	}
+	if l.Limiter == nil {
+		return nil
+	}
+	key, ok := costBudgetKey(ctx)
+	if !ok {
+		return nil
+	}
+	res, err := l.Limiter.Spend(ctx, key, cost, l.Budget, l.Window)
+	if err != nil {
+		return limitError(err)
+	}
+	if !res.Allowed {
+		return limitError(apperr.CostBudgetExceeded(cost, res.Remaining, res.RetryAfter))
+	}
+	return nil
+}
+
+// ErrorPresenter で apperr.Error として扱えるよう、原因のエラーを持たせる
+func limitError(err error) *gqlerror.Error {
+	return &gqlerror.Error{Message: err.Error(), Err: err}
+}
+
+// 予算を数える単位
+// ログインしている場合はユーザーごと、していない場合は IP アドレスごとに数える
+func costBudgetKey(ctx context.Context) (string, bool) {
+	if p, ok := auth.PrincipalFrom(ctx); ok {
+		return "graphql:cost:user:" + p.UserID, true
+	}
+	if ip, ok := ratelimit.ClientIPFrom(ctx); ok {
+		return "graphql:cost:ip:" + ip, true
+	}
+	return "", false
+}
+
+// 選択の入れ子の深さ
+// フラグメントは深さに数えない
+// イントロスペクションはスキーマだけから答えられるため、"__" で始まるフィールドは数えない
+func selectionDepth(set ast.SelectionSet) int {
+	depth := 0
+	for _, sel := range set {
+		var d int
+		switch s := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name, "__") {
+				continue
+			}
+			d = 1 + selectionDepth(s.SelectionSet)
+		case *ast.InlineFragment:
+			d = selectionDepth(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				d = selectionDepth(s.Definition.SelectionSet)
+			}
+		}
+		depth = max(depth, d)
+	}
+	return depth
+}
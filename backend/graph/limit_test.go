@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/ratelimit"
+)
+
+// 問い合わせの制限を加えたテスト用のクライアントを作る
+func newLimitedTestClient(limit *QueryLimit) *client.Client {
+	srv := handler.New(NewExecutableSchema(NewConfig(&Resolver{})))
+	srv.AddTransport(transport.POST{})
+	srv.SetErrorPresenter(ErrorPresenter)
+	srv.SetRecoverFunc(Recover)
+	srv.Use(limit)
+	srv.Use(extension.Introspection{})
+	return client.New(srv)
+}
+
+// 最初のエラーの extensions を返す
+func limitErrorExtensions(t *testing.T, err error) map[string]any {
+	t.Helper()
+	require.Error(t, err)
+	var errs gqlerror.List
+	require.NoError(t, json.Unmarshal([]byte(err.Error()), &errs))
+	require.NotEmpty(t, errs)
+	return errs[0].Extensions
+}
+
+type spendingLimiter struct {
+	keys    []string
+	costs   []int
+	allowed bool
+}
+
+func (l *spendingLimiter) Spend(ctx context.Context, key string, cost, budget int, window time.Duration) (ratelimit.Result, error) {
+	l.keys = append(l.keys, key)
+	l.costs = append(l.costs, cost)
+	if !l.allowed {
+		return ratelimit.Result{Allowed: false, Remaining: 3, RetryAfter: 1500 * time.Millisecond}, nil
+	}
+	return ratelimit.Result{Allowed: true, Remaining: budget - cost}, nil
+}
+
+func TestQueryLimit_深すぎる問い合わせを拒否する(t *testing.T) {
+	c := newLimitedTestClient(&QueryLimit{MaxDepth: 2, MaxComplexity: 1000})
+
+	var resp map[string]any
+	err := c.Post(`{ users { edges { node { id } } } }`, &resp)
+	ext := limitErrorExtensions(t, err)
+	assert.Equal(t, "QUERY_TOO_DEEP", ext["code"])
+	assert.Equal(t, float64(4), ext["depth"])
+	assert.Equal(t, float64(2), ext["maxDepth"])
+}
+
+func TestQueryLimit_イントロスペクションは深さに数えない(t *testing.T) {
+	c := newLimitedTestClient(&QueryLimit{MaxDepth: 1, MaxComplexity: 1000})
+
+	var resp map[string]any
+	err := c.Post(`{ __schema { types { fields { type { ofType { name } } } } } }`, &resp)
+	assert.NoError(t, err)
+}
+
+func TestQueryLimit_費用が上限を超える問い合わせを拒否する(t *testing.T) {
+	c := newLimitedTestClient(&QueryLimit{MaxDepth: 10, MaxComplexity: 30})
+
+	// node: 1 + id: 1 = 2, edges: 1 + 2 = 3, users: 1 + 10 * 3 = 31
+	var resp map[string]any
+	err := c.Post(`{ users(first: 10) { edges { node { id } } } }`, &resp)
+	ext := limitErrorExtensions(t, err)
+	assert.Equal(t, "QUERY_TOO_COMPLEX", ext["code"])
+	assert.Equal(t, float64(31), ext["cost"])
+	assert.Equal(t, float64(30), ext["maxCost"])
+}
+
+func TestQueryLimit_予算を使い切った呼び出し元を拒否する(t *testing.T) {
+	limiter := &spendingLimiter{}
+	c := newLimitedTestClient(&QueryLimit{
+		MaxDepth: 10, MaxComplexity: 1000, Budget: 100, Window: time.Minute, Limiter: limiter,
+	})
+
+	var resp map[string]any
+	err := c.Post(`{ __typename }`, &resp, withPrincipal(&auth.Principal{UserID: "1"}))
+	ext := limitErrorExtensions(t, err)
+	assert.Equal(t, "RATE_LIMITED", ext["code"])
+	assert.Equal(t, float64(1), ext["cost"])
+	assert.Equal(t, float64(3), ext["remainingBudget"])
+	assert.Equal(t, float64(2), ext["retryAfter"])
+	assert.Equal(t, []string{"graphql:cost:user:1"}, limiter.keys)
+}
+
+func TestQueryLimit_予算の範囲内は実行する(t *testing.T) {
+	limiter := &spendingLimiter{allowed: true}
+	c := newLimitedTestClient(&QueryLimit{
+		MaxDepth: 10, MaxComplexity: 1000, Budget: 100, Window: time.Minute, Limiter: limiter,
+	})
+
+	var resp struct {
+		Typename string `json:"__typename"`
+	}
+	err := c.Post(`{ __typename }`, &resp, func(bd *client.Request) {
+		bd.HTTP = bd.HTTP.WithContext(ratelimit.WithClientIP(bd.HTTP.Context(), "192.0.2.1"))
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Query", resp.Typename)
+	assert.Equal(t, []string{"graphql:cost:ip:192.0.2.1"}, limiter.keys)
+	assert.Equal(t, []int{1}, limiter.costs)
+}
+
+func Test_一覧の費用は件数を掛けて桁あふれしない(t *testing.T) {
+	assert.Equal(t, 31, listComplexity(3, 10))
+	assert.Equal(t, 1, listComplexity(3, -1))
+	assert.Equal(t, math.MaxInt, listComplexity(math.MaxInt/2, 3))
+}
@@ -0,0 +1,58 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/dataloader"
+	"github.com/yDog-1/wodun/backend/service"
+)
+
+// リクエストごとの DataLoader
+// 一覧の各行から関連を取得する resolver は、サービスを直接呼ばずにここから取得する
+type Loaders struct {
+	Users *dataloader.Loader[string, *model.User]
+}
+
+func NewLoaders(users *service.UserService) *Loaders {
+	return &Loaders{
+		Users: dataloader.New(
+			dataloader.FromSlice(users.GetUsersByIDs, func(u *model.User) string { return u.ID }),
+			error(domain.ErrUserNotFound),
+		),
+	}
+}
+
+type loadersKey struct{}
+
+// リクエストごとに DataLoader を作って context に設定するミドルウェア
+// 取得した値はリクエストの間だけ保持し、リクエストをまたいで共有しない
+func LoaderMiddleware(users *service.UserService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), loadersKey{}, NewLoaders(users))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func loadersFrom(ctx context.Context) (*Loaders, bool) {
+	l, ok := ctx.Value(loadersKey{}).(*Loaders)
+	return l, ok
+}
+
+// IDのユーザーを取得する
+// ミドルウェアで DataLoader が設定されていない場合は、サービスから直接取得する
+func (r *Resolver) loadUser(ctx context.Context, id string) (*model.User, error) {
+	if l, ok := loadersFrom(ctx); ok {
+		// 取得した結果はユーザーのIDで引くため、表記の違うIDもそろえてから渡す
+		id, err := domain.CanonicalUserID(id)
+		if err != nil {
+			return nil, err
+		}
+		return l.Users.Load(ctx, id)
+	}
+	return r.UserService.GetUserByID(ctx, id)
+}
@@ -0,0 +1,66 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/dataloader"
+)
+
+func TestLoaders_ユーザーをまとめて取得する(t *testing.T) {
+	const (
+		id1     = "0192f5b0-6c1e-7a3b-8c4d-5e6f7a8b9c0d"
+		id2     = "0192f5b0-6c1e-7a3b-8c4d-5e6f7a8b9c0e"
+		missing = "0192f5b0-6c1e-7a3b-8c4d-5e6f7a8b9c0f"
+	)
+	var mu sync.Mutex
+	var batches [][]string
+	loaders := &Loaders{
+		Users: dataloader.New(func(ctx context.Context, ids []string) (map[string]*model.User, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			batches = append(batches, ids)
+			res := map[string]*model.User{}
+			for _, id := range ids {
+				if id != missing {
+					res[id] = &model.User{ID: id}
+				}
+			}
+			return res, nil
+		}, error(domain.ErrUserNotFound)),
+	}
+	c := newTestClient(&Resolver{})
+	withLoaders := func(bd *client.Request) {
+		bd.HTTP = bd.HTTP.WithContext(context.WithValue(bd.HTTP.Context(), loadersKey{}, loaders))
+	}
+
+	var resp struct {
+		Nodes []*struct{ ID string }
+	}
+	ids := []string{
+		toGlobalID("User", id1),
+		toGlobalID("User", id2),
+		toGlobalID("User", missing),
+		toGlobalID("User", "not-a-uuid"),
+		// 大文字で指定しても同じユーザーとして扱う
+		toGlobalID("User", strings.ToUpper(id1)),
+	}
+	c.MustPost(`query($ids: [ID!]!) { nodes(ids: $ids) { id } }`, &resp, client.Var("ids", ids), withLoaders)
+
+	require.Len(t, resp.Nodes, 5)
+	assert.Equal(t, toGlobalID("User", id1), resp.Nodes[0].ID)
+	assert.Equal(t, toGlobalID("User", id2), resp.Nodes[1].ID)
+	assert.Nil(t, resp.Nodes[2])
+	assert.Nil(t, resp.Nodes[3])
+	assert.Equal(t, toGlobalID("User", id1), resp.Nodes[4].ID)
+	// 同じリクエストの取得は1回のクエリにまとまる
+	require.Len(t, batches, 1)
+	assert.ElementsMatch(t, []string{id1, id2, missing}, batches[0])
+}
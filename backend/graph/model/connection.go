@@ -0,0 +1,9 @@
+package model
+
+import "github.com/yDog-1/wodun/backend/pkg/pagination"
+
+// 一覧のフィールドの Connection と Edge は、pagination の型の別名として定義する
+type (
+	UserConnection = pagination.Connection[*User]
+	UserEdge       = pagination.Edge[*User]
+)
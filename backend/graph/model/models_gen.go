@@ -2,6 +2,20 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// グローバルIDで再取得できるオブジェクト
+type Node interface {
+	IsNode()
+	// 型の名前と公開用のIDを符号化したグローバルID
+	GetID() string
+}
+
 // 認証成功時のペイロード
 type AuthPayload struct {
 	AccessToken  string `json:"accessToken"`
@@ -12,7 +26,9 @@ type AuthPayload struct {
 
 // ユーザー作成時の入力データ
 type CreateUserInput struct {
-	UniqueName  string `json:"uniqueName"`
+	// 英数字とアンダースコアで3文字以上30文字以下
+	UniqueName string `json:"uniqueName"`
+	// 30文字以下。絵文字などは見た目の1文字を1文字として数える
 	DisplayName string `json:"displayName"`
 	Email       string `json:"email"`
 }
@@ -20,20 +36,150 @@ type CreateUserInput struct {
 type Mutation struct {
 }
 
+// 外部アカウントでの新規登録時の入力データ
+type OAuthSignupInput struct {
+	UniqueName  string `json:"uniqueName"`
+	DisplayName string `json:"displayName"`
+}
+
+// 確認待ちのメールアドレスの変更
+type PendingEmailChange struct {
+	// 変更後のメールアドレス
+	Email string `json:"email"`
+	// 確認リンクの有効期限
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// 確認待ちの電話番号の変更
+type PendingPhoneChange struct {
+	// 変更後の電話番号。E.164 形式
+	Phone string `json:"phone"`
+	// 確認リンクの有効期限
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 type Query struct {
 }
 
+// ログインしている端末ごとのセッション
+type Session struct {
+	ID string `json:"id"`
+	// 端末を見分けるための User-Agent の要約
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+	// 最後にトークンを更新した時刻
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	// このリクエストを送ったセッションかどうか
+	Current bool `json:"current"`
+}
+
 // ユーザー更新時の入力データ
 type UpdateUserInput struct {
-	ID          string  `json:"id"`
-	UniqueName  *string `json:"uniqueName,omitempty"`
 	DisplayName *string `json:"displayName,omitempty"`
-	Email       *string `json:"email,omitempty"`
 }
 
-type User struct {
-	ID          string `json:"id"`
-	UniqueName  string `json:"uniqueName"`
-	DisplayName string `json:"displayName"`
-	Email       string `json:"email"`
+// 管理者によるユーザーの操作の記録
+type UserAuditLog struct {
+	ID string `json:"id"`
+	// 操作した管理者のグローバルID。管理者が削除されている場合は null
+	ActorID *string `json:"actorId,omitempty"`
+	// 操作の対象のユーザーのグローバルID
+	UserID   string          `json:"userId"`
+	Action   UserAuditAction `json:"action"`
+	OldValue string          `json:"oldValue"`
+	NewValue string          `json:"newValue"`
+	// 操作の理由
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// 流量を制限する単位
+type RateLimitKey string
+
+const (
+	// クライアントの IP アドレス
+	RateLimitKeyIP RateLimitKey = "IP"
+	// ログインしているユーザー
+	RateLimitKeyUser RateLimitKey = "USER"
+	// 引数 email のメールアドレス
+	RateLimitKeyEmail RateLimitKey = "EMAIL"
+	// 引数 phone の電話番号
+	RateLimitKeyPhone RateLimitKey = "PHONE"
+)
+
+var AllRateLimitKey = []RateLimitKey{
+	RateLimitKeyIP,
+	RateLimitKeyUser,
+	RateLimitKeyEmail,
+	RateLimitKeyPhone,
+}
+
+func (e RateLimitKey) IsValid() bool {
+	switch e {
+	case RateLimitKeyIP, RateLimitKeyUser, RateLimitKeyEmail, RateLimitKeyPhone:
+		return true
+	}
+	return false
+}
+
+func (e RateLimitKey) String() string {
+	return string(e)
+}
+
+func (e *RateLimitKey) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RateLimitKey(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RateLimitKey", str)
+	}
+	return nil
+}
+
+func (e RateLimitKey) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// 管理者によるユーザーの操作の種類
+type UserAuditAction string
+
+const (
+	// 固有名の変更
+	UserAuditActionRename UserAuditAction = "RENAME"
+)
+
+var AllUserAuditAction = []UserAuditAction{
+	UserAuditActionRename,
+}
+
+func (e UserAuditAction) IsValid() bool {
+	switch e {
+	case UserAuditActionRename:
+		return true
+	}
+	return false
+}
+
+func (e UserAuditAction) String() string {
+	return string(e)
+}
+
+func (e *UserAuditAction) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserAuditAction(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserAuditAction", str)
+	}
+	return nil
+}
+
+func (e UserAuditAction) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
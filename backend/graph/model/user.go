@@ -0,0 +1,25 @@
+package model
+
+import "github.com/yDog-1/wodun/backend/pkg/auth"
+
+// ユーザー
+// GraphQL では email などの非公開の項目を null にすることがあるが、サービスでは常に値を持つため手書きで定義する
+type User struct {
+	// UUIDv7 形式の公開用のID。GraphQL ではグローバルIDにして返す
+	ID          string `json:"id"`
+	UniqueName  string `json:"uniqueName"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+	// メールアドレスの所有を確認したかどうか。GraphQL には公開しない
+	EmailVerified bool `json:"-"`
+	// E.164 形式の電話番号
+	Phone *string   `json:"phone,omitempty"`
+	Role  auth.Role `json:"role"`
+}
+
+func (User) IsNode() {}
+
+func (u User) GetID() string { return u.ID }
+
+// 非公開の項目を閲覧できる本人のID
+func (u User) OwnerID() string { return u.ID }
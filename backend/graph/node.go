@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+)
+
+// nodes で一度に取得できるIDの数
+const maxNodeIDs = 100
+
+// nodes に渡したIDが多すぎる
+var errTooManyNodeIDs = apperr.Validation(apperr.Field("ids", "must contain at most 100 ids"))
+
+// 公開用のIDから Node を取得する関数
+// オブジェクトが存在しない場合は nil を返す
+type nodeLoader func(r *Resolver, ctx context.Context, id string) (model.Node, error)
+
+// グローバルIDの型の名前と、その型のオブジェクトを取得する関数の対応
+// Node を実装する型を増やした場合はここに登録する
+var nodeLoaders = map[string]nodeLoader{
+	"User": loadNode(func(r *Resolver, ctx context.Context, id string) (*model.User, error) {
+		user, err := r.loadUser(ctx, id)
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil, nil
+		}
+		return user, err
+	}),
+}
+
+// 型ごとの取得関数を nodeLoader にする
+// 取得した値が nil の場合に、nil でない Node として返さないようにする
+func loadNode[T interface {
+	model.Node
+	comparable
+}](load func(r *Resolver, ctx context.Context, id string) (T, error)) nodeLoader {
+	return func(r *Resolver, ctx context.Context, id string) (model.Node, error) {
+		v, err := load(r, ctx, id)
+		var zero T
+		if err != nil || v == zero {
+			return nil, err
+		}
+		return v, nil
+	}
+}
+
+// 型の名前と公開用のIDからグローバルIDを作る
+// グローバルIDは "User:<公開用のID>" を base64url で符号化したもの
+func toGlobalID(typename, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(typename + ":" + id))
+}
+
+// グローバルIDを型の名前と公開用のIDに戻す
+func fromGlobalID(globalID string) (typename, id string, ok bool) {
+	b, err := base64.RawURLEncoding.DecodeString(globalID)
+	if err != nil {
+		return "", "", false
+	}
+	typename, id, ok = strings.Cut(string(b), ":")
+	if !ok || typename == "" || id == "" {
+		return "", "", false
+	}
+	return typename, id, true
+}
+
+// 引数のユーザーのグローバルIDを公開用のIDに戻す
+// path は誤りを返す場合の引数の名前
+func userIDFromGlobal(path, globalID string) (string, error) {
+	typename, id, ok := fromGlobalID(globalID)
+	if !ok || typename != "User" {
+		return "", apperr.Validation(apperr.Field(path, "invalid user id"))
+	}
+	return id, nil
+}
+
+// グローバルIDの型に登録された関数で Node を取得する
+// 形式の誤ったIDや、登録されていない型のIDの場合は nil を返す
+func (r *Resolver) loadNode(ctx context.Context, globalID string) (model.Node, error) {
+	typename, id, ok := fromGlobalID(globalID)
+	if !ok {
+		return nil, nil
+	}
+	load, ok := nodeLoaders[typename]
+	if !ok {
+		return nil, nil
+	}
+	return load(r, ctx, id)
+}
@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/graph/model"
+)
+
+func TestGlobalID(t *testing.T) {
+	globalID := toGlobalID("User", "0192f5b0-6c1e-7a3b-8c4d-5e6f7a8b9c0d")
+	typename, id, ok := fromGlobalID(globalID)
+	require.True(t, ok)
+	assert.Equal(t, "User", typename)
+	assert.Equal(t, "0192f5b0-6c1e-7a3b-8c4d-5e6f7a8b9c0d", id)
+
+	for _, globalID := range []string{"", "!!", "VXNlcg", toGlobalID("User", ""), toGlobalID("", "1")} {
+		_, _, ok := fromGlobalID(globalID)
+		assert.False(t, ok, globalID)
+	}
+
+	_, err := userIDFromGlobal("id", toGlobalID("Post", "1"))
+	assert.Error(t, err)
+}
+
+// User の取得関数を、id が "1" のユーザーだけを返す関数に差し替える
+func stubUserLoader(t *testing.T) {
+	orig := nodeLoaders["User"]
+	nodeLoaders["User"] = loadNode(func(r *Resolver, ctx context.Context, id string) (*model.User, error) {
+		if id != "1" {
+			return nil, nil
+		}
+		return &model.User{ID: "1", UniqueName: "ydog"}, nil
+	})
+	t.Cleanup(func() { nodeLoaders["User"] = orig })
+}
+
+func TestNode_グローバルIDの型に応じてオブジェクトを返す(t *testing.T) {
+	stubUserLoader(t)
+	c := newTestClient(&Resolver{})
+
+	var resp struct {
+		Node *struct {
+			Typename   string `json:"__typename"`
+			ID         string
+			UniqueName string
+		}
+	}
+	query := `query($id: ID!) { node(id: $id) { __typename id ... on User { uniqueName } } }`
+	c.MustPost(query, &resp, client.Var("id", toGlobalID("User", "1")))
+	require.NotNil(t, resp.Node)
+	assert.Equal(t, "User", resp.Node.Typename)
+	assert.Equal(t, toGlobalID("User", "1"), resp.Node.ID)
+	assert.Equal(t, "ydog", resp.Node.UniqueName)
+
+	// 存在しないオブジェクトや、登録されていない型のIDは null になる
+	for _, id := range []string{toGlobalID("User", "2"), toGlobalID("Post", "1"), "invalid"} {
+		resp.Node = nil
+		c.MustPost(query, &resp, client.Var("id", id))
+		assert.Nil(t, resp.Node, id)
+	}
+}
+
+func TestNodes_IDと同じ順に返す(t *testing.T) {
+	stubUserLoader(t)
+	c := newTestClient(&Resolver{})
+
+	var resp struct {
+		Nodes []*struct{ ID string }
+	}
+	ids := []string{toGlobalID("User", "2"), toGlobalID("User", "1")}
+	c.MustPost(`query($ids: [ID!]!) { nodes(ids: $ids) { id } }`, &resp, client.Var("ids", ids))
+	require.Len(t, resp.Nodes, 2)
+	assert.Nil(t, resp.Nodes[0])
+	assert.Equal(t, toGlobalID("User", "1"), resp.Nodes[1].ID)
+
+	many := make([]string, maxNodeIDs+1)
+	for i := range many {
+		many[i] = toGlobalID("User", "1")
+	}
+	err := c.Post(`query($ids: [ID!]!) { nodes(ids: $ids) { id } }`, &resp, client.Var("ids", many))
+	assert.ErrorContains(t, err, "must contain at most 100 ids")
+}
+
+func TestUserAuditLog_削除された管理者のIDはnullにする(t *testing.T) {
+	r := &userAuditLogResolver{&Resolver{}}
+	actorID := "1"
+
+	id, err := r.ActorID(context.Background(), &model.UserAuditLog{ActorID: &actorID})
+	require.NoError(t, err)
+	require.NotNil(t, id)
+	assert.Equal(t, toGlobalID("User", "1"), *id)
+
+	id, err = r.ActorID(context.Background(), &model.UserAuditLog{})
+	require.NoError(t, err)
+	assert.Nil(t, id)
+}
@@ -0,0 +1,20 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/yDog-1/wodun/backend/graph/model"
+)
+
+// ユーザーのトークンを発行して AuthPayload を組み立てる
+func (r *Resolver) authPayload(ctx context.Context, user *model.User) (*model.AuthPayload, error) {
+	at, rt, err := r.TokenService.GenerateToken(ctx, user.ID, user.UniqueName, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AuthPayload{
+		AccessToken:  at,
+		RefreshToken: rt,
+		User:         user,
+	}, nil
+}
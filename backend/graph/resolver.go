@@ -1,7 +1,23 @@
 package graph
 
+import (
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/ratelimit"
+	"github.com/yDog-1/wodun/backend/service"
+)
+
 // This file will not be regenerated automatically.
 //
 // It serves as dependency injection for your app, add any dependencies you require here.
 
-type Resolver struct{}
+type Resolver struct {
+	UserService        *service.UserService
+	TokenService       *auth.TokenService
+	MagicLinkService   *service.MagicLinkService
+	EmailChangeService *service.EmailChangeService
+	PhoneChangeService *service.PhoneChangeService
+	// Google ログインが設定されていない場合は nil
+	GoogleService *service.OIDCService
+	// nil の場合は流量を制限しない
+	RateLimiter *ratelimit.Limiter
+}
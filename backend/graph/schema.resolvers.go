@@ -6,44 +6,370 @@ package graph
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"sync"
 
+	"github.com/yDog-1/wodun/backend/domain"
 	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/pagination"
 )
 
 // CreateUser is the resolver for the createUser field.
 func (r *mutationResolver) CreateUser(ctx context.Context, input model.CreateUserInput) (*model.AuthPayload, error) {
-	panic(fmt.Errorf("not implemented: CreateUser - createUser"))
+	id, err := r.UserService.CreateUser(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.UserService.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return r.authPayload(ctx, user)
 }
 
 // UpdateUser is the resolver for the updateUser field.
 func (r *mutationResolver) UpdateUser(ctx context.Context, id string, input model.UpdateUserInput) (bool, error) {
-	panic(fmt.Errorf("not implemented: UpdateUser - updateUser"))
+	userID, err := userIDFromGlobal("id", id)
+	if err != nil {
+		return false, err
+	}
+	// 本人以外のユーザー情報は更新できない
+	// 表記の違う本人のIDも受け付けるよう、そろえてから比べる
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return false, auth.ErrUnauthenticated
+	}
+	userID, err = domain.CanonicalUserID(userID)
+	if err != nil || p.UserID != userID {
+		return false, errForbidden
+	}
+	if err := r.UserService.UpdateUser(ctx, userID, &input); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RequestEmailChange is the resolver for the requestEmailChange field.
+func (r *mutationResolver) RequestEmailChange(ctx context.Context, email string) (*model.PendingEmailChange, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	return r.EmailChangeService.Request(ctx, p.UserID, email)
+}
+
+// ConfirmEmailChange is the resolver for the confirmEmailChange field.
+func (r *mutationResolver) ConfirmEmailChange(ctx context.Context, token string) (*model.User, error) {
+	return r.EmailChangeService.Confirm(ctx, token)
+}
+
+// CancelEmailChange is the resolver for the cancelEmailChange field.
+func (r *mutationResolver) CancelEmailChange(ctx context.Context) (bool, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return false, auth.ErrUnauthenticated
+	}
+	if err := r.EmailChangeService.Cancel(ctx, p.UserID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RequestPhoneChange is the resolver for the requestPhoneChange field.
+func (r *mutationResolver) RequestPhoneChange(ctx context.Context, phone string) (*model.PendingPhoneChange, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	return r.PhoneChangeService.Request(ctx, p.UserID, phone)
+}
+
+// ConfirmPhoneChange is the resolver for the confirmPhoneChange field.
+func (r *mutationResolver) ConfirmPhoneChange(ctx context.Context, token string) (*model.User, error) {
+	return r.PhoneChangeService.Confirm(ctx, token)
+}
+
+// CancelPhoneChange is the resolver for the cancelPhoneChange field.
+func (r *mutationResolver) CancelPhoneChange(ctx context.Context) (bool, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return false, auth.ErrUnauthenticated
+	}
+	if err := r.PhoneChangeService.Cancel(ctx, p.UserID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RemovePhone is the resolver for the removePhone field.
+func (r *mutationResolver) RemovePhone(ctx context.Context) (bool, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return false, auth.ErrUnauthenticated
+	}
+	if err := r.PhoneChangeService.Remove(ctx, p.UserID); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // SendMagicLink is the resolver for the sendMagicLink field.
 func (r *mutationResolver) SendMagicLink(ctx context.Context, email string) (bool, error) {
-	panic(fmt.Errorf("not implemented: SendMagicLink - sendMagicLink"))
+	if err := r.MagicLinkService.SendEmail(ctx, email); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SendMagicLinkSms is the resolver for the sendMagicLinkSMS field.
+func (r *mutationResolver) SendMagicLinkSms(ctx context.Context, phone string) (bool, error) {
+	if err := r.MagicLinkService.SendSMS(ctx, phone); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // VerifyMagicLink is the resolver for the verifyMagicLink field.
 func (r *mutationResolver) VerifyMagicLink(ctx context.Context, token string) (*model.AuthPayload, error) {
-	panic(fmt.Errorf("not implemented: VerifyMagicLink - verifyMagicLink"))
+	user, err := r.MagicLinkService.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return r.authPayload(ctx, user)
+}
+
+// StartGoogleLogin is the resolver for the startGoogleLogin field.
+func (r *mutationResolver) StartGoogleLogin(ctx context.Context) (string, error) {
+	if r.GoogleService == nil {
+		return "", errGoogleLoginDisabled
+	}
+	return r.GoogleService.Start(ctx)
+}
+
+// LoginWithGoogle is the resolver for the loginWithGoogle field.
+func (r *mutationResolver) LoginWithGoogle(ctx context.Context, code string, state string, signup *model.OAuthSignupInput) (*model.AuthPayload, error) {
+	if r.GoogleService == nil {
+		return nil, errGoogleLoginDisabled
+	}
+	user, err := r.GoogleService.Login(ctx, code, state, signup)
+	if err != nil {
+		return nil, err
+	}
+	return r.authPayload(ctx, user)
 }
 
 // RefreshToken is the resolver for the refreshToken field.
 func (r *mutationResolver) RefreshToken(ctx context.Context, refreshToken string) (*model.AuthPayload, error) {
-	panic(fmt.Errorf("not implemented: RefreshToken - refreshToken"))
+	token, err := r.TokenService.VerifyRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.UserService.GetUserByID(ctx, token.Sub)
+	if err != nil {
+		return nil, err
+	}
+	at, rt, err := r.TokenService.RotateToken(ctx, token, user.UniqueName, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AuthPayload{
+		AccessToken:  at,
+		RefreshToken: rt,
+		User:         user,
+	}, nil
+}
+
+// RevokeSession is the resolver for the revokeSession field.
+func (r *mutationResolver) RevokeSession(ctx context.Context, id string) (bool, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return false, auth.ErrUnauthenticated
+	}
+	if err := r.TokenService.RevokeSession(ctx, p.UserID, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Logout is the resolver for the logout field.
+func (r *mutationResolver) Logout(ctx context.Context) (bool, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return false, auth.ErrUnauthenticated
+	}
+	if err := r.TokenService.Logout(ctx, p); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// LogoutAll is the resolver for the logoutAll field.
+func (r *mutationResolver) LogoutAll(ctx context.Context) (bool, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return false, auth.ErrUnauthenticated
+	}
+	if err := r.TokenService.LogoutAll(ctx, p.UserID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetUserRole is the resolver for the setUserRole field.
+func (r *mutationResolver) SetUserRole(ctx context.Context, id string, role auth.Role) (bool, error) {
+	userID, err := userIDFromGlobal("id", id)
+	if err != nil {
+		return false, err
+	}
+	if err := r.UserService.SetRole(ctx, userID, role); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RenameUser is the resolver for the renameUser field.
+func (r *mutationResolver) RenameUser(ctx context.Context, id string, uniqueName string, reason string) (*model.User, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	userID, err := userIDFromGlobal("id", id)
+	if err != nil {
+		return nil, err
+	}
+	return r.UserService.RenameUser(ctx, p.UserID, userID, uniqueName, reason)
 }
 
 // Me is the resolver for the me field.
 func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
-	panic(fmt.Errorf("not implemented: Me - me"))
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil, nil
+	}
+	return r.loadUser(ctx, p.UserID)
 }
 
 // User is the resolver for the user field.
 func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error) {
-	panic(fmt.Errorf("not implemented: User - user"))
+	userID, err := userIDFromGlobal("id", id)
+	if err != nil {
+		return nil, nil
+	}
+	user, err := r.loadUser(ctx, userID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Node is the resolver for the node field.
+func (r *queryResolver) Node(ctx context.Context, id string) (model.Node, error) {
+	return r.loadNode(ctx, id)
+}
+
+// Nodes is the resolver for the nodes field.
+func (r *queryResolver) Nodes(ctx context.Context, ids []string) ([]model.Node, error) {
+	if len(ids) > maxNodeIDs {
+		return nil, errTooManyNodeIDs
+	}
+	// DataLoader がまとめて取得できるよう、並行して取得する
+	nodes := make([]model.Node, len(ids))
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nodes[i], errs[i] = r.loadNode(ctx, id)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, first *int32, after *string) (*pagination.Connection[*model.User], error) {
+	page, err := pagination.NewPage(first, after)
+	if err != nil {
+		return nil, err
+	}
+	return r.UserService.ListUsers(ctx, page)
+}
+
+// Sessions is the resolver for the sessions field.
+func (r *queryResolver) Sessions(ctx context.Context) ([]*model.Session, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	sessions, err := r.TokenService.Sessions(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*model.Session, len(sessions))
+	for i, s := range sessions {
+		res[i] = &model.Session{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			Current:    s.ID == p.SessionID,
+		}
+	}
+	return res, nil
+}
+
+// PendingEmailChange is the resolver for the pendingEmailChange field.
+func (r *queryResolver) PendingEmailChange(ctx context.Context) (*model.PendingEmailChange, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	return r.EmailChangeService.Pending(ctx, p.UserID)
+}
+
+// PendingPhoneChange is the resolver for the pendingPhoneChange field.
+func (r *queryResolver) PendingPhoneChange(ctx context.Context) (*model.PendingPhoneChange, error) {
+	p, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	return r.PhoneChangeService.Pending(ctx, p.UserID)
+}
+
+// UserAuditLogs is the resolver for the userAuditLogs field.
+func (r *queryResolver) UserAuditLogs(ctx context.Context, userID string) ([]*model.UserAuditLog, error) {
+	id, err := userIDFromGlobal("userId", userID)
+	if err != nil {
+		return nil, err
+	}
+	return r.UserService.AuditLogs(ctx, id)
+}
+
+// ID is the resolver for the id field.
+func (r *userResolver) ID(ctx context.Context, obj *model.User) (string, error) {
+	return toGlobalID("User", obj.ID), nil
+}
+
+// ActorID is the resolver for the actorId field.
+func (r *userAuditLogResolver) ActorID(ctx context.Context, obj *model.UserAuditLog) (*string, error) {
+	if obj.ActorID == nil {
+		return nil, nil
+	}
+	id := toGlobalID("User", *obj.ActorID)
+	return &id, nil
+}
+
+// UserID is the resolver for the userId field.
+func (r *userAuditLogResolver) UserID(ctx context.Context, obj *model.UserAuditLog) (string, error) {
+	return toGlobalID("User", obj.UserID), nil
 }
 
 // Mutation returns MutationResolver implementation.
@@ -52,5 +378,13 @@ func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+// UserAuditLog returns UserAuditLogResolver implementation.
+func (r *Resolver) UserAuditLog() UserAuditLogResolver { return &userAuditLogResolver{r} }
+
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
+type userAuditLogResolver struct{ *Resolver }
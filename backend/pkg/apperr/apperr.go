@@ -0,0 +1,183 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// エラーの種類
+// GraphQL のエラーの extensions.code としてクライアントに返すため、値は変更しない
+type Code string
+
+const (
+	CodeNotFound        Code = "NOT_FOUND"
+	CodeConflict        Code = "CONFLICT"
+	CodeValidation      Code = "VALIDATION_FAILED"
+	CodeUnauthenticated Code = "UNAUTHENTICATED"
+	CodeForbidden       Code = "FORBIDDEN"
+	CodeRateLimited     Code = "RATE_LIMITED"
+	CodeQueryTooDeep    Code = "QUERY_TOO_DEEP"
+	CodeQueryTooComplex Code = "QUERY_TOO_COMPLEX"
+	CodeInternal        Code = "INTERNAL"
+)
+
+// 種類をクライアントに伝えるエラー
+// Message はクライアントに返すため、内部の情報を含めない
+type Error struct {
+	Code    Code
+	Message string
+	// 誤りのある入力の項目。Code が CodeValidation の場合に設定する
+	Fields []FieldError
+	// 値が他と衝突した項目。Code が CodeConflict の場合に設定する
+	Field string
+	// 再試行できるまでの時間。Code が CodeRateLimited の場合に設定する
+	RetryAfter time.Duration
+	// 問い合わせの深さまたは費用と、その上限
+	// Code が CodeQueryTooDeep か CodeQueryTooComplex の場合と、費用の予算を超えて CodeRateLimited になった場合に設定する
+	Amount, Limit int
+	// 同じ種類のエラーをクライアントが区別するための理由。空でない場合に設定する
+	Reason string
+	// 原因となったエラー。ログに残すためのもので、クライアントには返さない
+	Err error
+
+	// Wrap で複製する前のエラー。errors.Is で元のエラーと一致させる
+	origin *Error
+}
+
+// 入力の項目ごとの誤り
+type FieldError struct {
+	// 項目の位置。"input.email" のようにドットで区切る
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap で複製したエラーを、複製元のエラーと一致させる
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && e.origin != nil && e.origin == t
+}
+
+// 原因となったエラーを添えて複製する
+// e 自体は変更しないため、パッケージ変数のエラーにも使える
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	if e.origin != nil {
+		c.origin = e.origin
+	} else {
+		c.origin = e
+	}
+	return &c
+}
+
+// 理由とメッセージを変えて複製する
+// 複製したエラーは e とも一致するため、e で判別していた呼び出し元はそのまま扱える
+func (e *Error) WithReason(reason, message string) *Error {
+	c := e.Wrap(nil)
+	c.Reason = reason
+	c.Message = message
+	return c
+}
+
+// 入力の誤りを1つ作る
+func Field(path, message string) FieldError {
+	return FieldError{Path: path, Message: message}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Code: CodeNotFound, Message: message}
+}
+
+// field は値が衝突した入力の項目
+func Conflict(field, message string) *Error {
+	return &Error{Code: CodeConflict, Message: message, Field: field}
+}
+
+// 入力の誤りをまとめて1つのエラーにする
+func Validation(fields ...FieldError) *Error {
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f.Path + ": " + f.Message
+	}
+	return &Error{
+		Code:    CodeValidation,
+		Message: strings.Join(msgs, "; "),
+		Fields:  fields,
+	}
+}
+
+func Unauthenticated(message string) *Error {
+	return &Error{Code: CodeUnauthenticated, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Code: CodeForbidden, Message: message}
+}
+
+func RateLimited(retryAfter time.Duration) *Error {
+	return &Error{Code: CodeRateLimited, Message: "rate limit exceeded", RetryAfter: retryAfter}
+}
+
+// 問い合わせの入れ子が深すぎる
+func QueryTooDeep(depth, limit int) *Error {
+	return &Error{
+		Code:    CodeQueryTooDeep,
+		Message: fmt.Sprintf("query depth %d exceeds the limit of %d", depth, limit),
+		Amount:  depth,
+		Limit:   limit,
+	}
+}
+
+// 1回の問い合わせの費用が上限を超えた
+func QueryTooComplex(cost, limit int) *Error {
+	return &Error{
+		Code:    CodeQueryTooComplex,
+		Message: fmt.Sprintf("query cost %d exceeds the limit of %d", cost, limit),
+		Amount:  cost,
+		Limit:   limit,
+	}
+}
+
+// 問い合わせの費用が、呼び出し元に残っている予算を超えた
+// remaining は残っている予算
+func CostBudgetExceeded(cost, remaining int, retryAfter time.Duration) *Error {
+	return &Error{
+		Code:       CodeRateLimited,
+		Message:    fmt.Sprintf("query cost %d exceeds the remaining budget of %d", cost, remaining),
+		RetryAfter: retryAfter,
+		Amount:     cost,
+		Limit:      remaining,
+	}
+}
+
+// 予期しないエラー
+// クライアントには原因を伏せ、固定のメッセージだけを返す
+func Internal(err error) *Error {
+	return &Error{Code: CodeInternal, Message: "internal server error", Err: err}
+}
+
+// エラーの種類を返す
+// Error を含まないエラーは予期しないエラーとして CodeInternal を返す
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
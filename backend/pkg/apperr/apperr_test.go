@@ -0,0 +1,74 @@
+package apperr_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+)
+
+func TestWrap(t *testing.T) {
+	errNotFound := apperr.NotFound("user not found")
+
+	err := errNotFound.Wrap(sql.ErrNoRows)
+	assert.ErrorIs(t, err, errNotFound)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Equal(t, "user not found: sql: no rows in result set", err.Error())
+	// 複製元は変更しない
+	assert.NoError(t, errNotFound.Err)
+
+	// 複製をさらに複製しても、最初のエラーと一致する
+	assert.ErrorIs(t, err.Wrap(errors.New("other")), errNotFound)
+	// 同じ種類でも、別のエラーとは一致しない
+	assert.NotErrorIs(t, err, apperr.NotFound("user not found"))
+}
+
+func TestWithReason(t *testing.T) {
+	errInvalid := apperr.Unauthenticated("invalid token")
+
+	err := errInvalid.WithReason("TOKEN_EXPIRED", "token expired")
+	assert.ErrorIs(t, err, errInvalid)
+	assert.Equal(t, apperr.CodeUnauthenticated, err.Code)
+	assert.Equal(t, "TOKEN_EXPIRED", err.Reason)
+	assert.Equal(t, "token expired", err.Error())
+	// 複製元は変更しない
+	assert.Empty(t, errInvalid.Reason)
+
+	// 理由を付けたエラーを包んでも、理由を付けたエラーと元のエラーの両方に一致する
+	wrapped := fmt.Errorf("%w: %w", err, errors.New("exp"))
+	assert.ErrorIs(t, wrapped, err)
+	assert.ErrorIs(t, wrapped, errInvalid)
+}
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want apperr.Code
+	}{
+		{"nil", nil, ""},
+		{"Error", apperr.Forbidden("forbidden"), apperr.CodeForbidden},
+		{"ラップされた Error", fmt.Errorf("%w: expired", apperr.Unauthenticated("invalid token")), apperr.CodeUnauthenticated},
+		{"RateLimited", apperr.RateLimited(time.Second), apperr.CodeRateLimited},
+		{"Error 以外", sql.ErrNoRows, apperr.CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, apperr.CodeOf(tt.err))
+		})
+	}
+}
+
+func TestValidation(t *testing.T) {
+	err := apperr.Validation(
+		apperr.Field("input.uniqueName", "must be at least 3 characters"),
+		apperr.Field("input.email", "invalid email address"),
+	)
+	assert.Equal(t, apperr.CodeValidation, err.Code)
+	assert.Len(t, err.Fields, 2)
+	assert.Equal(t, "input.uniqueName: must be at least 3 characters; input.email: invalid email address", err.Error())
+}
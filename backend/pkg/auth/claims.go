@@ -6,13 +6,17 @@ import (
 
 // アクセストークンの claims
 type accessClaims struct {
-	Issuer    string           `json:"iss"`
-	Subject   string           `json:"sub"`
-	Audience  jwt.ClaimStrings `json:"aud"`
-	ExpiresAt *jwt.NumericDate `json:"exp"`
-	IssuedAt  *jwt.NumericDate `json:"iat"`
-	ID        string           `json:"jti"`
-	UniqueName string         `json:"uname"`
+	Issuer     string           `json:"iss"`
+	Subject    string           `json:"sub"`
+	Audience   jwt.ClaimStrings `json:"aud"`
+	ExpiresAt  *jwt.NumericDate `json:"exp"`
+	NotBefore  *jwt.NumericDate `json:"nbf,omitempty"`
+	IssuedAt   *jwt.NumericDate `json:"iat"`
+	ID         string           `json:"jti"`
+	UniqueName string           `json:"uname"`
+	Role       Role             `json:"role"`
+	// トークンを発行したセッション (リフレッシュトークンのファミリー)
+	SessionID string `json:"sid,omitempty"`
 }
 
 // GetExpirationTime implements the Claims interface.
@@ -22,7 +26,7 @@ func (a accessClaims) GetExpirationTime() (*jwt.NumericDate, error) {
 
 // GetNotBefore implements the Claims interface.
 func (a accessClaims) GetNotBefore() (*jwt.NumericDate, error) {
-	return nil, nil
+	return a.NotBefore, nil
 }
 
 // GetIssuedAt implements the Claims interface.
@@ -49,8 +53,13 @@ func (a accessClaims) GetSubject() (string, error) {
 type refreshClaims struct {
 	Issuer    string           `json:"iss"`
 	Subject   string           `json:"sub"`
+	Audience  jwt.ClaimStrings `json:"aud"`
 	ExpiresAt *jwt.NumericDate `json:"exp"`
+	NotBefore *jwt.NumericDate `json:"nbf,omitempty"`
+	IssuedAt  *jwt.NumericDate `json:"iat"`
 	ID        string           `json:"jti"`
+	// ローテーションで引き継がれるファミリーID
+	Family string `json:"fam"`
 }
 
 // GetExpirationTime implements the Claims interface.
@@ -60,17 +69,17 @@ func (r refreshClaims) GetExpirationTime() (*jwt.NumericDate, error) {
 
 // GetNotBefore implements the Claims interface.
 func (r refreshClaims) GetNotBefore() (*jwt.NumericDate, error) {
-	return nil, nil
+	return r.NotBefore, nil
 }
 
 // GetIssuedAt implements the Claims interface.
 func (r refreshClaims) GetIssuedAt() (*jwt.NumericDate, error) {
-	return nil, nil
+	return r.IssuedAt, nil
 }
 
 // GetAudience implements the Claims interface.
 func (r refreshClaims) GetAudience() (jwt.ClaimStrings, error) {
-	return nil, nil
+	return r.Audience, nil
 }
 
 // GetIssuer implements the Claims interface.
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+)
+
+// 呼び出し元が認証されていない
+var ErrUnauthenticated = apperr.Unauthenticated("unauthenticated")
+
+// 認証されたリクエストの呼び出し元
+type Principal struct {
+	UserID     string
+	UniqueName string
+	Role       Role
+	// アクセストークンの JTI
+	TokenID string
+	// アクセストークンを発行したセッション
+	SessionID string
+	ExpiresAt time.Time
+}
+
+type principalKey struct{}
+
+// context に呼び出し元を設定する
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// context から呼び出し元を取得する
+// 未認証の場合は false を返す
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// アクセストークンに署名する鍵
+type SigningKey struct {
+	// JWT ヘッダーの kid
+	ID         string
+	PrivateKey ed25519.PrivateKey
+}
+
+// アクセストークンの検証だけに使う鍵
+// ローテーションで署名に使わなくなった鍵は、発行済みのトークンが失効するまで残す
+type VerificationKey struct {
+	ID        string
+	PublicKey ed25519.PublicKey
+}
+
+// アクセストークンの署名鍵と検証鍵の集合
+type KeySet struct {
+	signing SigningKey
+	verify  map[string]ed25519.PublicKey
+}
+
+// 署名に使う鍵がない
+var ErrNoSigningKey = errors.New("signing key is not set")
+
+// KeySetを生成する
+// 署名鍵は検証鍵としても登録される
+func NewKeySet(signing SigningKey, retired ...VerificationKey) (*KeySet, error) {
+	if signing.ID == "" || len(signing.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, ErrNoSigningKey
+	}
+	verify := map[string]ed25519.PublicKey{
+		signing.ID: signing.PrivateKey.Public().(ed25519.PublicKey),
+	}
+	for _, k := range retired {
+		if k.ID == "" || len(k.PublicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid verification key: %q", k.ID)
+		}
+		if _, ok := verify[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id: %q", k.ID)
+		}
+		verify[k.ID] = k.PublicKey
+	}
+	return &KeySet{signing: signing, verify: verify}, nil
+}
+
+// 新しい署名鍵を生成する
+func GenerateSigningKey(id string) (SigningKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{ID: id, PrivateKey: priv}, nil
+}
+
+// ディレクトリ内の PEM ファイルから KeySet を読み込む
+// ファイル名 (拡張子を除く) を kid とし、signingID の鍵で署名する
+// 秘密鍵 (PKCS #8) と公開鍵 (PKIX) のどちらも置けるため、退役した鍵は公開鍵だけを残せばよい
+//
+//	openssl genpkey -algorithm ed25519 -out keys/2025-01.pem
+func LoadKeySet(dir, signingID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var signing *SigningKey
+	var retired []VerificationKey
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseKeyPEM(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		switch k := key.(type) {
+		case ed25519.PrivateKey:
+			if id == signingID {
+				signing = &SigningKey{ID: id, PrivateKey: k}
+				continue
+			}
+			retired = append(retired, VerificationKey{ID: id, PublicKey: k.Public().(ed25519.PublicKey)})
+		case ed25519.PublicKey:
+			retired = append(retired, VerificationKey{ID: id, PublicKey: k})
+		}
+	}
+	if signing == nil {
+		return nil, fmt.Errorf("%w: private key %q is not found in %s", ErrNoSigningKey, signingID, dir)
+	}
+	return NewKeySet(*signing, retired...)
+}
+
+// PEM から Ed25519 の秘密鍵または公開鍵を取り出す
+func parseKeyPEM(b []byte) (any, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.New("key is not ed25519")
+	}
+}
+
+// kid に対応する検証鍵を返す
+func (ks *KeySet) verificationKey(kid string) (ed25519.PublicKey, bool) {
+	k, ok := ks.verify[kid]
+	return k, ok
+}
+
+// JWK Set (RFC 7517) の形式で公開鍵を返す
+func (ks *KeySet) JWKS() ([]byte, error) {
+	type jwk struct {
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+	}
+	ids := make([]string, 0, len(ks.verify))
+	for id := range ks.verify {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	keys := make([]jwk, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, jwk{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(ks.verify[id]),
+			Kid: id,
+			Use: "sig",
+			Alg: "EdDSA",
+		})
+	}
+	return json.Marshal(map[string]any{"keys": keys})
+}
+
+// /.well-known/jwks.json で公開鍵を配信するハンドラー
+func JWKSHandler(ks *KeySet) (http.Handler, error) {
+	body, err := ks.JWKS()
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		// 鍵のローテーションが検証側に伝わるよう、キャッシュは短くする
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_, _ = w.Write(body)
+	}), nil
+}
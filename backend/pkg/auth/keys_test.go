@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenService_KeyRotation(t *testing.T) {
+	ctx := context.Background()
+	store := &mockTokenStore{}
+	clock := mockClock{}
+
+	oldKey, err := GenerateSigningKey("2025-01")
+	require.NoError(t, err)
+	newKey, err := GenerateSigningKey("2025-02")
+	require.NoError(t, err)
+
+	oldKS, err := NewKeySet(oldKey)
+	require.NoError(t, err)
+	before, err := NewTokenService(store, oldKS, clock, testTokenOptions)
+	require.NoError(t, err)
+	oldToken, _, err := before.GenerateToken(ctx, testUserID, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	// 署名鍵を切り替えても、古い鍵を検証用に残していれば発行済みのトークンを検証できる
+	rotatedKS, err := NewKeySet(newKey, VerificationKey{ID: oldKey.ID, PublicKey: oldKey.PrivateKey.Public().(ed25519.PublicKey)})
+	require.NoError(t, err)
+	after, err := NewTokenService(store, rotatedKS, clock, testTokenOptions)
+	require.NoError(t, err)
+
+	parsed, err := after.ParseAccessToken(ctx, oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, testUserID, parsed.Sub)
+
+	// 新しいトークンは新しい鍵の kid で署名される
+	newToken, _, err := after.GenerateToken(ctx, testUserID, "testuser", RoleMember)
+	require.NoError(t, err)
+	header, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "2025-02", header.Header["kid"])
+	assert.Equal(t, "EdDSA", header.Header["alg"])
+
+	// 古い鍵を取り除くと、古い鍵で署名されたトークンは検証できない
+	withoutOld, err := NewKeySet(newKey)
+	require.NoError(t, err)
+	removed, err := NewTokenService(store, withoutOld, clock, testTokenOptions)
+	require.NoError(t, err)
+	_, err = removed.ParseAccessToken(ctx, oldToken)
+	assert.Error(t, err)
+}
+
+func TestTokenService_ParseAccessToken_HS256は受け付けない(t *testing.T) {
+	ts, err := NewTokenService(&mockTokenStore{}, newTestKeySet(t, "test-key"), mockClock{}, testTokenOptions)
+	require.NoError(t, err)
+
+	// 公開鍵を HMAC の鍵として使う、いわゆるアルゴリズム混同攻撃
+	pub := ts.keys.signing.PrivateKey.Public().(ed25519.PublicKey)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": testIssuer, "sub": testUserID, "aud": testAudience, "jti": "jti", "uname": "testuser",
+		"exp": mockClock{}.Now().Unix() + 60, "iat": mockClock{}.Now().Unix(),
+	})
+	token.Header["kid"] = "test-key"
+	s, err := token.SignedString([]byte(pub))
+	require.NoError(t, err)
+
+	_, err = ts.ParseAccessToken(context.Background(), s)
+	assert.Error(t, err)
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	signing, err := GenerateSigningKey("2025-02")
+	require.NoError(t, err)
+	retired, err := GenerateSigningKey("2025-01")
+	require.NoError(t, err)
+	retiredPub := retired.PrivateKey.Public().(ed25519.PublicKey)
+	ks, err := NewKeySet(signing, VerificationKey{ID: retired.ID, PublicKey: retiredPub})
+	require.NoError(t, err)
+
+	h, err := JWKSHandler(ks)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/jwk-set+json", rec.Header().Get("Content-Type"))
+
+	var body struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Keys, 2)
+
+	// 秘密鍵の情報は含まれない
+	for _, k := range body.Keys {
+		assert.Equal(t, "OKP", k["kty"])
+		assert.Equal(t, "Ed25519", k["crv"])
+		assert.Equal(t, "EdDSA", k["alg"])
+		assert.NotContains(t, k, "d")
+	}
+	assert.Equal(t, "2025-01", body.Keys[0]["kid"])
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(retiredPub), body.Keys[0]["x"])
+	assert.Equal(t, "2025-02", body.Keys[1]["kid"])
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+
+	signing, err := GenerateSigningKey("2025-02")
+	require.NoError(t, err)
+	retired, err := GenerateSigningKey("2025-01")
+	require.NoError(t, err)
+
+	// 署名鍵は秘密鍵、退役した鍵は公開鍵だけを置く
+	b, err := x509.MarshalPKCS8PrivateKey(signing.PrivateKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2025-02.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}), 0o600))
+	b, err = x509.MarshalPKIXPublicKey(retired.PrivateKey.Public())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2025-01.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}), 0o644))
+
+	ks, err := LoadKeySet(dir, "2025-02")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-02", ks.signing.ID)
+	assert.True(t, signing.PrivateKey.Equal(ks.signing.PrivateKey))
+	_, ok := ks.verificationKey("2025-01")
+	assert.True(t, ok)
+
+	// 公開鍵しかない鍵では署名できない
+	_, err = LoadKeySet(dir, "2025-01")
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Authorization ヘッダーの Bearer トークンを検証し、呼び出し元を context に設定するミドルウェア
+// ヘッダーがない場合は未認証のまま次へ渡し、認証が必要かどうかは各フィールドで判断する
+// ヘッダーがあるのに検証できない場合は 401 を返す
+func Middleware(ts *TokenService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// ログイン時にセッションの端末を記録できるよう、認証の有無に関わらず設定する
+			r = r.WithContext(withUserAgent(r.Context(), r.UserAgent()))
+
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			raw, ok := bearerToken(header)
+			if !ok {
+				unauthorized(w, "invalid_request", "")
+				return
+			}
+			// ログアウトなどで失効したトークンも ParseAccessToken で拒否される
+			token, err := ts.ParseAccessToken(r.Context(), raw)
+			if errors.Is(err, ErrTokenExpired) {
+				// 更新すれば使えることをクライアントが判断できるよう、説明を添える
+				unauthorized(w, "invalid_token", ErrTokenExpired.Message)
+				return
+			}
+			if errors.Is(err, ErrInvalidToken) {
+				unauthorized(w, "invalid_token", "")
+				return
+			}
+			if err != nil {
+				log.Printf("failed to parse access token: %v", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			ctx := WithPrincipal(r.Context(), &Principal{
+				UserID:     token.Sub,
+				UniqueName: token.Uname,
+				Role:       token.Role,
+				TokenID:    token.Jti,
+				SessionID:  token.Fam,
+				ExpiresAt:  token.Exp,
+			})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// "Bearer <token>" からトークンを取り出す
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// RFC 6750 に従って 401 を返す
+// description が空でない場合は error_description に設定する
+func unauthorized(w http.ResponseWriter, code, description string) {
+	challenge := `Bearer error="` + code + `"`
+	if description != "" {
+		challenge += `, error_description="` + description + `"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
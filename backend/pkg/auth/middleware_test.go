@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ミドルウェアを通したリクエストの呼び出し元を返す
+func serveWithMiddleware(t *testing.T, ts *TokenService, header string) (*httptest.ResponseRecorder, *Principal) {
+	t.Helper()
+	var got *Principal
+	h := Middleware(ts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFrom(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/query", nil)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec, got
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	clock := mockClock{}
+	store := newMemoryTokenStore(clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	accessToken, _, err := ts.GenerateToken(ctx, testUserID, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	t.Run("ヘッダーがない場合は未認証のまま通す", func(t *testing.T) {
+		rec, p := serveWithMiddleware(t, ts, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Nil(t, p)
+	})
+
+	t.Run("有効なトークンで呼び出し元を設定する", func(t *testing.T) {
+		rec, p := serveWithMiddleware(t, ts, "Bearer "+accessToken)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, p)
+		assert.Equal(t, testUserID, p.UserID)
+		assert.Equal(t, "testuser", p.UniqueName)
+		assert.NotEmpty(t, p.TokenID)
+		assert.NotEmpty(t, p.SessionID)
+	})
+
+	t.Run("Bearer以外のスキームは拒否する", func(t *testing.T) {
+		rec, p := serveWithMiddleware(t, ts, "Basic dXNlcjpwYXNz")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "invalid_request")
+		assert.Nil(t, p)
+	})
+
+	t.Run("不正なトークンは拒否する", func(t *testing.T) {
+		rec, p := serveWithMiddleware(t, ts, "Bearer invalid.token.string")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "invalid_token")
+		assert.Nil(t, p)
+	})
+
+	t.Run("失効したトークンは拒否する", func(t *testing.T) {
+		parsed, err := ts.ParseAccessToken(ctx, accessToken)
+		require.NoError(t, err)
+		_, err = store.DeleteJTI(ctx, parsed.Sub, parsed.Jti)
+		require.NoError(t, err)
+
+		rec, p := serveWithMiddleware(t, ts, "Bearer "+accessToken)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Nil(t, p)
+	})
+}
+
+func TestMiddleware_期限切れのトークンは説明を添えて拒否する(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ts, err := NewTokenService(newMemoryTokenStore(clock), newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	accessToken, _, err := ts.GenerateToken(ctx, testUserID, "testuser", RoleMember)
+	require.NoError(t, err)
+	clock.Advance(testTokenOptions.AccessTTL + testTokenOptions.Leeway)
+
+	rec, p := serveWithMiddleware(t, ts, "Bearer "+accessToken)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer error="invalid_token", error_description="token expired"`, rec.Header().Get("WWW-Authenticate"))
+	assert.Nil(t, p)
+}
@@ -0,0 +1,42 @@
+package auth
+
+import "github.com/yDog-1/wodun/backend/pkg/apperr"
+
+// ユーザーの権限
+// 上位の権限は下位の権限でできることを全て含む
+type Role string
+
+const (
+	// 一般のユーザー
+	RoleMember Role = "member"
+	// 投稿やユーザーを管理するユーザー
+	RoleModerator Role = "moderator"
+	// くるんちゅの管理・運営を行うユーザー
+	RoleAdmin Role = "admin"
+)
+
+// 存在しない権限が指定された
+var ErrInvalidRole = apperr.Validation(apperr.Field("role", "invalid role"))
+
+// 権限の強さ。存在しない権限は 0 になる
+func (r Role) level() int {
+	switch r {
+	case RoleMember:
+		return 1
+	case RoleModerator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// 定義された権限かどうか
+func (r Role) Valid() bool {
+	return r.level() > 0
+}
+
+// required の権限でできることを r の権限で行えるかどうか
+func (r Role) Includes(required Role) bool {
+	return r.Valid() && required.Valid() && r.level() >= required.level()
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRole_Includes(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleMember, RoleMember, true},
+		{RoleMember, RoleModerator, false},
+		{RoleModerator, RoleMember, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{Role("owner"), RoleMember, false},
+		{RoleAdmin, Role("owner"), false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.role.Includes(tt.required), "%s includes %s", tt.role, tt.required)
+	}
+}
+
+func TestTokenService_権限をアクセストークンに含める(t *testing.T) {
+	ctx := context.Background()
+	ts, err := NewTokenService(&mockTokenStore{}, newTestKeySet(t, "test-key"), mockClock{}, testTokenOptions)
+	require.NoError(t, err)
+
+	accessToken, _, err := ts.GenerateToken(ctx, testUserID, "testuser", RoleModerator)
+	require.NoError(t, err)
+	parsed, err := ts.ParseAccessToken(ctx, accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, RoleModerator, parsed.Role)
+
+	// 存在しない権限ではトークンを発行しない
+	_, _, err = ts.GenerateToken(ctx, testUserID, "testuser", Role("owner"))
+	assert.ErrorIs(t, err, ErrInvalidRole)
+}
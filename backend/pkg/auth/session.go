@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+)
+
+// 指定したセッションが存在しない
+var ErrSessionNotFound = apperr.NotFound("session not found")
+
+// ログインした端末ごとのセッション
+// セッションIDはリフレッシュトークンのファミリーと同じ値になる
+type Session struct {
+	ID string
+	// 端末を見分けるための User-Agent の要約
+	UserAgent string
+	CreatedAt time.Time
+	// 最後にトークンを更新した時刻
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// ユーザーの有効なセッションを、最近使われた順に返す
+func (ts *TokenService) Sessions(ctx context.Context, userID string) ([]Session, error) {
+	sessions, err := ts.store.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// 指定したセッションで発行された全てのトークンを失効させる
+func (ts *TokenService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	ok, err := ts.revokeFamily(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// 呼び出し元のセッションを失効させる
+// セッションを持たない古いトークンでも、提示されたアクセストークンは必ず拒否リストに加える
+func (ts *TokenService) Logout(ctx context.Context, p *Principal) error {
+	if p.SessionID != "" {
+		if _, err := ts.revokeFamily(ctx, p.UserID, p.SessionID); err != nil {
+			return err
+		}
+	}
+	if _, err := ts.store.DeleteJTI(ctx, p.UserID, p.TokenID); err != nil {
+		return err
+	}
+	return ts.store.DenyJTI(ctx, p.ExpiresAt.Add(ts.leeway), p.TokenID)
+}
+
+// ユーザーの全てのセッションを失効させる
+func (ts *TokenService) LogoutAll(ctx context.Context, userID string) error {
+	sessions, err := ts.store.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if _, err := ts.revokeFamily(ctx, userID, s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ファミリーを失効させ、まだ有効期限内のアクセストークンを拒否リストに加える
+// ファミリーが存在しなかった場合は false を返す
+func (ts *TokenService) revokeFamily(ctx context.Context, id, family string) (bool, error) {
+	jtis, err := ts.store.RevokeFamily(ctx, id, family)
+	if err != nil {
+		return false, err
+	}
+	if len(jtis) == 0 {
+		return false, nil
+	}
+	// ファミリーのアクセストークンは、最も新しいものでも今から accessTTL 以内に失効する
+	exp := ts.clock.Now().Add(ts.accessTTL + ts.leeway)
+	if err := ts.store.DenyJTI(ctx, exp, jtis...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type userAgentKey struct{}
+
+// context にリクエストの User-Agent を設定する
+func withUserAgent(ctx context.Context, ua string) context.Context {
+	return context.WithValue(ctx, userAgentKey{}, ua)
+}
+
+// context からリクエストの User-Agent を取得する
+func userAgentFrom(ctx context.Context) string {
+	ua, _ := ctx.Value(userAgentKey{}).(string)
+	return ua
+}
+
+// User-Agent の最大長。判別できない User-Agent はこの長さで切り詰めて表示する
+const maxUserAgentLabel = 64
+
+// User-Agent から "Chrome on macOS" のような表示用の要約を作る
+// ブラウザと OS のどちらも判別できない場合は元の文字列を切り詰めて返す
+func userAgentLabel(ua string) string {
+	browser := matchUserAgent(ua, []uaPattern{
+		// Chromium 系のブラウザは Chrome/ と Safari/ も含むため、先に判定する
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	})
+	platform := matchUserAgent(ua, []uaPattern{
+		// iOS と Android の User-Agent は Mac OS X と Linux も含むため、先に判定する
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	})
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	ua = strings.TrimSpace(ua)
+	if r := []rune(ua); len(r) > maxUserAgentLabel {
+		return string(r[:maxUserAgentLabel])
+	}
+	return ua
+}
+
+type uaPattern struct {
+	token string
+	label string
+}
+
+// 最初に一致したパターンのラベルを返す
+func matchUserAgent(ua string, patterns []uaPattern) string {
+	for _, p := range patterns {
+		if strings.Contains(ua, p.token) {
+			return p.label
+		}
+	}
+	return ""
+}
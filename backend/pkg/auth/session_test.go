@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// テスト用にログインし、発行されたアクセストークンの呼び出し元を返す
+func login(t *testing.T, ts *TokenService, ctx context.Context, id string) (*Principal, string) {
+	t.Helper()
+	at, rt, err := ts.GenerateToken(ctx, id, "testuser", RoleMember)
+	require.NoError(t, err)
+	parsed, err := ts.ParseAccessToken(ctx, at)
+	require.NoError(t, err)
+	return &Principal{
+		UserID:    parsed.Sub,
+		TokenID:   parsed.Jti,
+		SessionID: parsed.Fam,
+		ExpiresAt: parsed.Exp,
+	}, rt
+}
+
+func TestTokenService_Sessions(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ts, err := NewTokenService(newMemoryTokenStore(clock), newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	phoneCtx := withUserAgent(ctx, "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1")
+	phone, phoneRefresh := login(t, ts, phoneCtx, testUserID)
+	clock.Advance(time.Minute)
+	laptopCtx := withUserAgent(ctx, "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0")
+	laptop, _ := login(t, ts, laptopCtx, testUserID)
+
+	sessions, err := ts.Sessions(ctx, testUserID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, laptop.SessionID, sessions[0].ID, "most recently used session comes first")
+	assert.Equal(t, "Firefox on Linux", sessions[0].UserAgent)
+	assert.Equal(t, phone.SessionID, sessions[1].ID)
+	assert.Equal(t, "Safari on iOS", sessions[1].UserAgent)
+
+	// リフレッシュすると最終利用時刻が更新される
+	clock.Advance(time.Minute)
+	verified, err := ts.VerifyRefreshToken(ctx, phoneRefresh)
+	require.NoError(t, err)
+	_, _, err = ts.RotateToken(ctx, verified, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	sessions, err = ts.Sessions(ctx, testUserID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, phone.SessionID, sessions[0].ID)
+	assert.Equal(t, clock.Now(), sessions[0].LastUsedAt)
+	assert.Equal(t, clock.Now().Add(-2*time.Minute), sessions[0].CreatedAt)
+	assert.Equal(t, clock.Now().Add(testTokenOptions.RefreshTTL), sessions[0].ExpiresAt)
+}
+
+func TestTokenService_RevokeSession(t *testing.T) {
+	ctx := context.Background()
+	clock := mockClock{}
+	store := newMemoryTokenStore(clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	lost, lostRefresh := login(t, ts, ctx, testUserID)
+	current, _ := login(t, ts, ctx, testUserID)
+
+	// 紛失した端末のセッションを失効させる
+	require.NoError(t, ts.RevokeSession(ctx, testUserID, lost.SessionID))
+
+	_, err = ts.VerifyRefreshToken(ctx, lostRefresh)
+	assert.Error(t, err)
+	denied, err := store.IsDeniedJTI(ctx, lost.TokenID)
+	require.NoError(t, err)
+	assert.True(t, denied, "access token of the revoked session should be denied")
+
+	sessions, err := ts.Sessions(ctx, testUserID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, current.SessionID, sessions[0].ID)
+
+	// 存在しないセッションや他人のセッションは失効させられない
+	err = ts.RevokeSession(ctx, testUserID, lost.SessionID)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	err = ts.RevokeSession(ctx, testOtherUserID, current.SessionID)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestTokenService_Logout(t *testing.T) {
+	ctx := context.Background()
+	clock := mockClock{}
+	store := newMemoryTokenStore(clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	p, refreshToken := login(t, ts, ctx, testUserID)
+	other, _ := login(t, ts, ctx, testUserID)
+
+	require.NoError(t, ts.Logout(ctx, p))
+
+	_, err = ts.VerifyRefreshToken(ctx, refreshToken)
+	assert.Error(t, err)
+	denied, err := store.IsDeniedJTI(ctx, p.TokenID)
+	require.NoError(t, err)
+	assert.True(t, denied)
+
+	// 他の端末のセッションは残る
+	sessions, err := ts.Sessions(ctx, testUserID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, other.SessionID, sessions[0].ID)
+}
+
+func TestTokenService_LogoutAll(t *testing.T) {
+	ctx := context.Background()
+	clock := mockClock{}
+	store := newMemoryTokenStore(clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	first, _ := login(t, ts, ctx, testUserID)
+	second, _ := login(t, ts, ctx, testUserID)
+	others, _ := login(t, ts, ctx, testOtherUserID)
+
+	require.NoError(t, ts.LogoutAll(ctx, testUserID))
+
+	sessions, err := ts.Sessions(ctx, testUserID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+	for _, p := range []*Principal{first, second} {
+		denied, err := store.IsDeniedJTI(ctx, p.TokenID)
+		require.NoError(t, err)
+		assert.True(t, denied)
+	}
+
+	// 他のユーザーには影響しない
+	denied, err := store.IsDeniedJTI(ctx, others.TokenID)
+	require.NoError(t, err)
+	assert.False(t, denied)
+}
+
+func TestUserAgentLabel(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", "Chrome on Windows"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15", "Safari on macOS"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.0.0 Mobile/15E148 Safari/604.1", "Chrome on iOS"},
+		{"curl/8.4.0", "curl/8.4.0"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, userAgentLabel(tt.ua), tt.ua)
+	}
+}
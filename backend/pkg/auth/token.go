@@ -4,19 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
 )
 
-const (
-	// アクセストークンの有効期限 (1時間)
-	accessTokenExpire = time.Hour
-	// リフレッシュトークンの有効期限 (1週間)
-	refreshTokenExpire = time.Hour * 24 * 7
-)
+// リフレッシュトークンの署名鍵に求める最小の長さ (HS256 の出力長)
+const MinRefreshSecretLength = 32
 
 type clock interface {
 	Now() time.Time
@@ -30,206 +26,428 @@ type Token struct {
 	Aud   jwt.ClaimStrings
 	Jti   string
 	Uname string
+	// アクセストークンを発行した時点のユーザーの権限
+	Role Role
+	// リフレッシュトークンのファミリー
+	// 一度のログインで発行されたトークンは全て同じファミリーに属し、これをセッションとして扱う
+	Fam string
 }
 
 type TokenService struct {
-	store         TokenStore
-	issuer        string
-	audience      string
-	accessSecret  []byte
+	store    TokenStore
+	issuer   string
+	audience string
+	// アクセストークンは公開鍵で検証できるよう EdDSA で署名する
+	keys *KeySet
+	// リフレッシュトークンはこのサーバーでしか検証しないため HS256 で署名する
 	refreshSecret []byte
-	clock         clock
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+	// nbf, iat, exp の検証で許容する時刻のずれ
+	leeway time.Duration
+	clock  clock
 }
 
 type TokenStore interface {
-	// jtiを保存する
-	SaveJTI(ctx context.Context, jti string) error
+	// ユーザーIDに紐づけてjtiを保存する。expを過ぎたjtiは無効になる
+	SaveJTI(ctx context.Context, id, jti string, exp time.Time) error
 	// jtiが存在するか確認する
 	ExistsJTI(ctx context.Context, id, jti string) (bool, error)
+	// jtiを削除する。削除できた場合はtrueを返す
+	DeleteJTI(ctx context.Context, id, jti string) (bool, error)
+	// jtiをリフレッシュトークンのファミリーに加える。ファミリーはexpまで保持される
+	AddFamilyJTI(ctx context.Context, id, family string, exp time.Time, jtis ...string) error
+	// ファミリーに属する全てのjtiとセッションを削除し、削除したjtiを返す
+	RevokeFamily(ctx context.Context, id, family string) ([]string, error)
+	// jtiを拒否リストに加える。expを過ぎると拒否リストから外れる
+	DenyJTI(ctx context.Context, exp time.Time, jtis ...string) error
+	// jtiが拒否リストに含まれているか確認する
+	IsDeniedJTI(ctx context.Context, jti string) (bool, error)
+
+	// セッションを保存する。セッションは s.ExpiresAt まで保持される
+	SaveSession(ctx context.Context, id string, s Session) error
+	// セッションの最終利用時刻と有効期限を更新する
+	TouchSession(ctx context.Context, id, family string, usedAt, exp time.Time) error
+	// ユーザーの有効なセッションを返す
+	ListSessions(ctx context.Context, id string) ([]Session, error)
+}
+
+var (
+	// 使用済みのリフレッシュトークンが再び提示された
+	ErrRefreshTokenReused = apperr.Unauthenticated("refresh token has already been used")
+
+	// トークンを受け付けられない。以下のエラーは全てこのエラーを包む
+	ErrInvalidToken = apperr.Unauthenticated("invalid token")
+	// 形式や署名が正しくない、または必須の claim がない
+	ErrTokenMalformed = fmt.Errorf("%w: malformed", ErrInvalidToken)
+	// 有効期限を過ぎている
+	// クライアントがトークンの更新や再ログインを判断できるよう、理由を付けて返す
+	ErrTokenExpired = ErrInvalidToken.WithReason("TOKEN_EXPIRED", "token expired")
+	// nbf や iat が未来の時刻になっている
+	ErrTokenNotValidYet = fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	// 発行者が設定と一致しない
+	ErrTokenInvalidIssuer = fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	// 対象者に設定の audience が含まれない
+	ErrTokenInvalidAudience = fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	// ストアから jti が削除されている
+	ErrTokenRevoked = fmt.Errorf("%w: revoked", ErrInvalidToken)
+)
+
+// TokenService の設定
+type TokenOptions struct {
+	Issuer   string
+	Audience string
+	// リフレッシュトークンの HS256 署名に使う共有鍵。MinRefreshSecretLength バイト以上にする
+	RefreshSecret []byte
+	AccessTTL     time.Duration
+	RefreshTTL    time.Duration
+	// nbf, iat, exp の検証で許容する時刻のずれ
+	Leeway time.Duration
 }
 
 // TokenServiceを生成する
-func NewTokenService(store TokenStore, clock clock) (*TokenService, error) {
+func NewTokenService(store TokenStore, keys *KeySet, clock clock, opts TokenOptions) (*TokenService, error) {
 	if store == nil {
 		return nil, errors.New("store is nil")
 	}
+	if keys == nil {
+		return nil, errors.New("keys is nil")
+	}
 	if clock == nil {
 		return nil, errors.New("clock is nil")
 	}
-	iss, ok := os.LookupEnv("TOKEN_ISSUER")
-	if !ok {
-		return nil, errors.New("TOKEN_ISSUER is not set")
+	if opts.Issuer == "" || opts.Audience == "" {
+		return nil, errors.New("issuer and audience must be set")
 	}
-	aud, ok := os.LookupEnv("TOKEN_AUDIENCE")
-	if !ok {
-		return nil, errors.New("TOKEN_AUDIENCE is not set")
+	if len(opts.RefreshSecret) < MinRefreshSecretLength {
+		return nil, fmt.Errorf("refresh secret must be at least %d bytes", MinRefreshSecretLength)
 	}
-	as, ok := os.LookupEnv("TOKEN_ACCESS_SECRET")
-	if !ok {
-		return nil, errors.New("TOKEN_ACCESS_SECRET is not set")
-	}
-	rs, ok := os.LookupEnv("TOKEN_REFRESH_SECRET")
-	if !ok {
-		return nil, errors.New("TOKEN_REFRESH_SECRET is not set")
+	if opts.AccessTTL <= 0 || opts.RefreshTTL <= 0 {
+		return nil, errors.New("token lifetimes must be positive")
 	}
 	return &TokenService{
 		store:         store,
-		issuer:        iss,
-		audience:      aud,
-		accessSecret:  []byte(as),
-		refreshSecret: []byte(rs),
+		issuer:        opts.Issuer,
+		audience:      opts.Audience,
+		keys:          keys,
+		refreshSecret: opts.RefreshSecret,
+		accessTTL:     opts.AccessTTL,
+		refreshTTL:    opts.RefreshTTL,
+		leeway:        opts.Leeway,
 		clock:         clock,
 	}, nil
 }
 
 // トークンを生成する
-func (ts *TokenService) GenerateToken(ctx context.Context, id, uniqueName string) (accessToken string, refreshToken string, err error) {
-	at, err := ts.generateAccessToken(ctx, id, uniqueName)
+// ログインごとに新しいリフレッシュトークンのファミリーを開始する
+func (ts *TokenService) GenerateToken(ctx context.Context, id, uniqueName string, role Role) (accessToken string, refreshToken string, err error) {
+	family := uuid.New().String()
+	at, rt, exp, err := ts.issueToken(ctx, id, uniqueName, role, family)
+	if err != nil {
+		return "", "", err
+	}
+	now := ts.clock.Now()
+	err = ts.store.SaveSession(ctx, id, Session{
+		ID:         family,
+		UserAgent:  userAgentLabel(userAgentFrom(ctx)),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  exp,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return at, rt, nil
+}
+
+// リフレッシュトークンを検証して、その内容を返す
+// 使用済みのトークンが再び提示された場合は、盗まれた可能性があるためファミリーごと失効させる
+// トークンは RotateToken で新しいトークンを発行するまで使用済みにしない
+func (ts *TokenService) VerifyRefreshToken(ctx context.Context, refreshToken string) (*Token, error) {
+	t, err := ts.parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := ts.store.ExistsJTI(ctx, t.Sub, t.Jti)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ts.refreshTokenMissing(ctx, t)
+	}
+	return t, nil
+}
+
+// 検証したリフレッシュトークンと同じファミリーで新しいトークンを発行し、検証したトークンを使用済みにする
+// セッションの最終利用時刻はこのときに更新する
+// 権限の変更はこのときに新しいアクセストークンへ反映される
+// 発行に失敗した場合は検証したトークンを残すため、クライアントは同じトークンで再試行できる
+func (ts *TokenService) RotateToken(ctx context.Context, verified *Token, uniqueName string, role Role) (accessToken string, refreshToken string, err error) {
+	if verified.Fam == "" {
+		return "", "", errors.New("family is not set")
+	}
+	at, rt, exp, err := ts.issueToken(ctx, verified.Sub, uniqueName, role, verified.Fam)
 	if err != nil {
 		return "", "", err
 	}
-	rt, err := ts.generateRefreshToken(ctx, id)
+	if err := ts.store.TouchSession(ctx, verified.Sub, verified.Fam, ts.clock.Now(), exp); err != nil {
+		return "", "", err
+	}
+	ok, err := ts.store.DeleteJTI(ctx, verified.Sub, verified.Jti)
 	if err != nil {
 		return "", "", err
 	}
+	if !ok {
+		// 検証から発行までの間に、同じトークンが別のリクエストで使われた
+		// 発行したトークンも同じファミリーに属するため、まとめて失効する
+		return "", "", ts.refreshTokenMissing(ctx, verified)
+	}
 	return at, rt, nil
 }
 
+// ストアに残っていないリフレッシュトークンが提示された場合のエラーを返す
+func (ts *TokenService) refreshTokenMissing(ctx context.Context, t *Token) error {
+	// 許容するずれを含めて期限切れになったトークンは、ストアから消えているだけで再利用ではない
+	if !ts.clock.Now().Before(t.Exp.Add(ts.leeway)) {
+		return ErrTokenExpired
+	}
+	if _, err := ts.revokeFamily(ctx, t.Sub, t.Fam); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// 指定したファミリーでアクセストークンとリフレッシュトークンを発行する
+// ファミリーの有効期限となるリフレッシュトークンの有効期限も返す
+func (ts *TokenService) issueToken(ctx context.Context, id, uniqueName string, role Role, family string) (string, string, time.Time, error) {
+	if !role.Valid() {
+		return "", "", time.Time{}, ErrInvalidRole
+	}
+	at, atJTI, err := ts.generateAccessToken(ctx, id, uniqueName, role, family)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	rt, rtJTI, exp, err := ts.generateRefreshToken(ctx, id, family)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	if err := ts.store.AddFamilyJTI(ctx, id, family, exp.Add(ts.leeway), atJTI, rtJTI); err != nil {
+		return "", "", time.Time{}, err
+	}
+	return at, rt, exp, nil
+}
+
 // アクセストークンを生成する
-func (ts *TokenService) generateAccessToken(ctx context.Context, id, uniqueName string) (string, error) {
+func (ts *TokenService) generateAccessToken(ctx context.Context, id, uniqueName string, role Role, family string) (string, string, error) {
 	jti := uuid.New().String()
+	now := ts.clock.Now()
+	exp := now.Add(ts.accessTTL)
 	claims := accessClaims{
 		Issuer:     ts.issuer,
 		Subject:    id,
 		Audience:   []string{ts.audience},
-		ExpiresAt:  jwt.NewNumericDate(ts.clock.Now().Add(accessTokenExpire)),
-		IssuedAt:   jwt.NewNumericDate(ts.clock.Now()),
+		ExpiresAt:  jwt.NewNumericDate(exp),
+		NotBefore:  jwt.NewNumericDate(now),
+		IssuedAt:   jwt.NewNumericDate(now),
 		ID:         jti,
 		UniqueName: uniqueName,
+		Role:       role,
+		SessionID:  family,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = ts.keys.signing.ID
 
-	tokenString, err := token.SignedString(ts.accessSecret)
+	tokenString, err := token.SignedString(ts.keys.signing.PrivateKey)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	if err := ts.store.SaveJTI(ctx, jti); err != nil {
-		return "", err
+	// 許容するずれの間は有効期限を過ぎても受け付けるため、jti もその分だけ長く残す
+	if err := ts.store.SaveJTI(ctx, id, jti, exp.Add(ts.leeway)); err != nil {
+		return "", "", err
 	}
 
-	return tokenString, nil
+	return tokenString, jti, nil
 }
 
 // リフレッシュトークンを生成する
-func (ts *TokenService) generateRefreshToken(ctx context.Context, id string) (string, error) {
+func (ts *TokenService) generateRefreshToken(ctx context.Context, id, family string) (string, string, time.Time, error) {
 	jti := uuid.New().String()
+	now := ts.clock.Now()
+	exp := now.Add(ts.refreshTTL)
 	claims := refreshClaims{
 		Issuer:    ts.issuer,
 		Subject:   id,
-		ExpiresAt: jwt.NewNumericDate(ts.clock.Now().Add(refreshTokenExpire)),
+		Audience:  []string{ts.audience},
+		ExpiresAt: jwt.NewNumericDate(exp),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
 		ID:        jti,
+		Family:    family,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString(ts.refreshSecret)
 	if err != nil {
-		return "", err
+		return "", "", time.Time{}, err
 	}
-	if err := ts.store.SaveJTI(ctx, jti); err != nil {
-		return "", err
+	// 許容するずれの間は有効期限を過ぎても受け付けるため、jti もその分だけ長く残す
+	if err := ts.store.SaveJTI(ctx, id, jti, exp.Add(ts.leeway)); err != nil {
+		return "", "", time.Time{}, err
 	}
 
-	return tokenString, nil
+	return tokenString, jti, exp, nil
 }
 
-func (ts *TokenService) ParseAccessToken(token string) (*Token, error) {
-	t, err := jwt.Parse(token, func(t *jwt.Token) (any, error) {
-		if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(ts.accessSecret), nil
-	})
-
-	if claims, ok := t.Claims.(jwt.MapClaims); ok && t.Valid {
-		exp, err := claims.GetExpirationTime()
-		if err != nil {
-			return nil, err
-		}
-		expUTC := exp.UTC()
-		iat, err := claims.GetIssuedAt()
-		if err != nil {
-			return nil, err
-		}
-		iatUTC := iat.UTC()
-		iss, err := claims.GetIssuer()
-		if err != nil {
-			return nil, err
-		}
-		sub, err := claims.GetSubject()
-		if err != nil {
-			return nil, err
-		}
-		aud, err := claims.GetAudience()
-		if err != nil {
-			return nil, err
-		}
-		jti, ok := claims["jti"].(string)
-		if !ok {
-			return nil, errors.New("jti is not set")
-		}
-		uname, ok := claims["uname"].(string)
+// アクセストークンを検証して、その内容を返す
+// 署名、発行者、対象者、有効期間に加えて、ストアに jti が残っているかを確認する
+func (ts *TokenService) ParseAccessToken(ctx context.Context, token string) (*Token, error) {
+	var claims accessClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		// kid で検証鍵を選ぶ。ローテーション前の鍵で署名されたトークンも検証できる
+		kid, _ := t.Header["kid"].(string)
+		key, ok := ts.keys.verificationKey(kid)
 		if !ok {
-			return nil, errors.New("uname is not set")
+			return nil, fmt.Errorf("unknown key id: %q", kid)
 		}
-		return &Token{
-			Exp:   expUTC,
-			Iat:   iatUTC,
-			Iss:   iss,
-			Sub:   sub,
-			Aud:   aud,
-			Jti:   jti,
-			Uname: uname,
-		}, nil
-	} else {
+		return key, nil
+	}, ts.parserOptions(jwt.SigningMethodEdDSA)...)
+	if err != nil {
+		return nil, classifyTokenError(err)
+	}
+	if claims.Subject == "" || claims.ID == "" || claims.UniqueName == "" {
+		return nil, fmt.Errorf("%w: required claims are not set", ErrTokenMalformed)
+	}
+	sub, err := parseSubject(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	// 権限を持たない古いトークンは、最も弱い権限として扱う
+	role := claims.Role
+	if role == "" {
+		role = RoleMember
+	}
+	if !role.Valid() {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrTokenMalformed, role)
+	}
+
+	t := &Token{
+		Exp:   claims.ExpiresAt.UTC(),
+		Iat:   claims.IssuedAt.UTC(),
+		Iss:   claims.Issuer,
+		Sub:   sub,
+		Aud:   claims.Audience,
+		Jti:   claims.ID,
+		Uname: claims.UniqueName,
+		Role:  role,
+		Fam:   claims.SessionID,
+	}
+	if err := ts.checkRevoked(ctx, t); err != nil {
 		return nil, err
 	}
+	return t, nil
 }
 
-func (ts *TokenService) ParseRefreshToken(token string) (*Token, error) {
-	t, err := jwt.Parse(token, func(t *jwt.Token) (any, error) {
-		if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(ts.refreshSecret), nil
-	})
+// リフレッシュトークンを検証して、その内容を返す
+// 失効の確認まで行うため、使用済みのトークンは ErrTokenRevoked になる
+func (ts *TokenService) ParseRefreshToken(ctx context.Context, token string) (*Token, error) {
+	t, err := ts.parseRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.checkRevoked(ctx, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
 
-	if claims, ok := t.Claims.(jwt.MapClaims); ok && t.Valid {
-		exp, err := claims.GetExpirationTime()
-		if err != nil {
-			return nil, err
-		}
-		expUTC := exp.UTC()
-		iss, err := claims.GetIssuer()
-		if err != nil {
-			return nil, err
-		}
-		sub, err := claims.GetSubject()
-		if err != nil {
-			return nil, err
-		}
-		jti, ok := claims["jti"].(string)
-		if !ok {
-			return nil, errors.New("jti is not set")
-		}
-		return &Token{
-			Exp: expUTC,
-			Iss: iss,
-			Sub: sub,
-			Jti: jti,
-		}, nil
-	} else {
+// 失効の確認を除いてリフレッシュトークンを検証する
+// 再利用の検知では、失効済みのトークンからもファミリーを取り出す必要がある
+func (ts *TokenService) parseRefreshToken(token string) (*Token, error) {
+	var claims refreshClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		return ts.refreshSecret, nil
+	}, ts.parserOptions(jwt.SigningMethodHS256)...)
+	if err != nil {
+		return nil, classifyTokenError(err)
+	}
+	if claims.Subject == "" || claims.ID == "" || claims.Family == "" {
+		return nil, fmt.Errorf("%w: required claims are not set", ErrTokenMalformed)
+	}
+	sub, err := parseSubject(claims.Subject)
+	if err != nil {
 		return nil, err
 	}
+
+	return &Token{
+		Exp: claims.ExpiresAt.UTC(),
+		Iat: claims.IssuedAt.UTC(),
+		Iss: claims.Issuer,
+		Sub: sub,
+		Aud: claims.Audience,
+		Jti: claims.ID,
+		Fam: claims.Family,
+	}, nil
+}
+
+// sub をユーザーIDとして検証し、小文字の UUID の形式にそろえる
+// ユーザーIDが数値だった頃に発行したトークンは、ユーザーを特定できないため受け付けない
+func parseSubject(sub string) (string, error) {
+	u, err := uuid.Parse(sub)
+	if err != nil {
+		return "", fmt.Errorf("%w: subject is not a user id: %w", ErrTokenMalformed, err)
+	}
+	return u.String(), nil
+}
+
+// 両方のトークンに共通する検証条件
+func (ts *TokenService) parserOptions(method jwt.SigningMethod) []jwt.ParserOption {
+	return []jwt.ParserOption{
+		jwt.WithValidMethods([]string{method.Alg()}),
+		jwt.WithIssuer(ts.issuer),
+		jwt.WithAudience(ts.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(ts.leeway),
+		jwt.WithTimeFunc(ts.clock.Now),
+	}
+}
+
+// ログアウトやファミリーの失効で jti が削除されていないか確認する
+func (ts *TokenService) checkRevoked(ctx context.Context, t *Token) error {
+	ok, err := ts.store.ExistsJTI(ctx, t.Sub, t.Jti)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTokenRevoked
+	}
+	denied, err := ts.store.IsDeniedJTI(ctx, t.Jti)
+	if err != nil {
+		return err
+	}
+	if denied {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// jwt の検証エラーを呼び出し元が判別できるエラーに変換する
+// 複数の検証に失敗した場合は、対象者、発行者、有効期間の順に優先する
+func classifyTokenError(err error) error {
+	var sentinel error
+	switch {
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		sentinel = ErrTokenInvalidAudience
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		sentinel = ErrTokenInvalidIssuer
+	case errors.Is(err, jwt.ErrTokenExpired):
+		sentinel = ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		sentinel = ErrTokenNotValidYet
+	default:
+		sentinel = ErrTokenMalformed
+	}
+	return fmt.Errorf("%w: %w", sentinel, err)
 }
@@ -2,17 +2,18 @@ package auth
 
 import (
 	"context"
-	"os"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 type mockTokenStore struct{}
 
-func (m *mockTokenStore) SaveJTI(ctx context.Context, jti string) error {
+func (m *mockTokenStore) SaveJTI(ctx context.Context, id, jti string, exp time.Time) error {
 	return nil
 }
 
@@ -20,101 +21,265 @@ func (m *mockTokenStore) ExistsJTI(ctx context.Context, id, jti string) (bool, e
 	return true, nil
 }
 
+func (m *mockTokenStore) DeleteJTI(ctx context.Context, id, jti string) (bool, error) {
+	return true, nil
+}
+
+func (m *mockTokenStore) AddFamilyJTI(ctx context.Context, id, family string, exp time.Time, jtis ...string) error {
+	return nil
+}
+
+func (m *mockTokenStore) RevokeFamily(ctx context.Context, id, family string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockTokenStore) DenyJTI(ctx context.Context, exp time.Time, jtis ...string) error {
+	return nil
+}
+
+func (m *mockTokenStore) IsDeniedJTI(ctx context.Context, jti string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockTokenStore) SaveSession(ctx context.Context, id string, s Session) error {
+	return nil
+}
+
+func (m *mockTokenStore) TouchSession(ctx context.Context, id, family string, usedAt, exp time.Time) error {
+	return nil
+}
+
+func (m *mockTokenStore) ListSessions(ctx context.Context, id string) ([]Session, error) {
+	return nil, nil
+}
+
+// メモリ上でJTIを保持するTokenStore
+// 有効期限の判定には注入した clock を用いる
+type memoryTokenStore struct {
+	clock    clock
+	saved    map[string]time.Time
+	families map[string][]string
+	denied   map[string]time.Time
+	sessions map[string]map[string]Session
+}
+
+func newMemoryTokenStore(c clock) *memoryTokenStore {
+	return &memoryTokenStore{
+		clock:    c,
+		saved:    map[string]time.Time{},
+		families: map[string][]string{},
+		denied:   map[string]time.Time{},
+		sessions: map[string]map[string]Session{},
+	}
+}
+
+func (m *memoryTokenStore) SaveJTI(ctx context.Context, id, jti string, exp time.Time) error {
+	m.saved[id+":"+jti] = exp
+	return nil
+}
+
+func (m *memoryTokenStore) ExistsJTI(ctx context.Context, id, jti string) (bool, error) {
+	exp, ok := m.saved[id+":"+jti]
+	return ok && m.clock.Now().Before(exp), nil
+}
+
+func (m *memoryTokenStore) DeleteJTI(ctx context.Context, id, jti string) (bool, error) {
+	ok, _ := m.ExistsJTI(ctx, id, jti)
+	delete(m.saved, id+":"+jti)
+	return ok, nil
+}
+
+func (m *memoryTokenStore) AddFamilyJTI(ctx context.Context, id, family string, exp time.Time, jtis ...string) error {
+	m.families[id+":"+family] = append(m.families[id+":"+family], jtis...)
+	return nil
+}
+
+func (m *memoryTokenStore) RevokeFamily(ctx context.Context, id, family string) ([]string, error) {
+	jtis := m.families[id+":"+family]
+	for _, jti := range jtis {
+		delete(m.saved, id+":"+jti)
+	}
+	delete(m.families, id+":"+family)
+	delete(m.sessions[id], family)
+	return jtis, nil
+}
+
+func (m *memoryTokenStore) DenyJTI(ctx context.Context, exp time.Time, jtis ...string) error {
+	for _, jti := range jtis {
+		m.denied[jti] = exp
+	}
+	return nil
+}
+
+func (m *memoryTokenStore) IsDeniedJTI(ctx context.Context, jti string) (bool, error) {
+	exp, ok := m.denied[jti]
+	return ok && m.clock.Now().Before(exp), nil
+}
+
+func (m *memoryTokenStore) SaveSession(ctx context.Context, id string, s Session) error {
+	if m.sessions[id] == nil {
+		m.sessions[id] = map[string]Session{}
+	}
+	m.sessions[id][s.ID] = s
+	return nil
+}
+
+func (m *memoryTokenStore) TouchSession(ctx context.Context, id, family string, usedAt, exp time.Time) error {
+	s, ok := m.sessions[id][family]
+	if !ok {
+		s = Session{ID: family, CreatedAt: usedAt}
+	}
+	s.LastUsedAt = usedAt
+	s.ExpiresAt = exp
+	return m.SaveSession(ctx, id, s)
+}
+
+func (m *memoryTokenStore) ListSessions(ctx context.Context, id string) ([]Session, error) {
+	var sessions []Session
+	for _, s := range m.sessions[id] {
+		if m.clock.Now().Before(s.ExpiresAt) {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
 type mockClock struct{}
 
 func (c mockClock) Now() time.Time {
 	return time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
 }
 
+// 任意に時刻を進められる clock
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
 const (
 	testIssuer        = "test-issuer"
 	testAudience      = "test-audience"
-	testAccessSecret  = "test-access-secret"
-	testRefreshSecret = "test-refresh-secret"
+	testRefreshSecret = "test-refresh-secret-0123456789abcdef"
+	testUserID        = "0192a6e0-7c4d-7b3a-8f2e-4d5c6b7a8e91"
+	testOtherUserID   = "0192a6e0-7c4d-7b3a-8f2e-4d5c6b7a8e92"
 )
 
-func TestMain(m *testing.M) {
-
-	// テスト実行前に環境変数を設定
-	_ = os.Setenv("TOKEN_ISSUER", testIssuer)
-	_ = os.Setenv("TOKEN_AUDIENCE", testAudience)
-	_ = os.Setenv("TOKEN_ACCESS_SECRET", testAccessSecret)
-	_ = os.Setenv("TOKEN_REFRESH_SECRET", testRefreshSecret)
-
-	// テストを実行
-	code := m.Run()
-
-	// テスト実行後に環境変数をクリーンアップ
-	_ = os.Unsetenv("TOKEN_ISSUER")
-	_ = os.Unsetenv("TOKEN_AUDIENCE")
-	_ = os.Unsetenv("TOKEN_ACCESS_SECRET")
-	_ = os.Unsetenv("TOKEN_REFRESH_SECRET")
+var testTokenOptions = TokenOptions{
+	Issuer:        testIssuer,
+	Audience:      testAudience,
+	RefreshSecret: []byte(testRefreshSecret),
+	AccessTTL:     time.Hour,
+	RefreshTTL:    7 * 24 * time.Hour,
+	Leeway:        30 * time.Second,
+}
 
-	os.Exit(code)
+// テスト用の署名鍵だけを持つ KeySet を生成する
+func newTestKeySet(t *testing.T, id string) *KeySet {
+	t.Helper()
+	key, err := GenerateSigningKey(id)
+	require.NoError(t, err)
+	ks, err := NewKeySet(key)
+	require.NoError(t, err)
+	return ks
 }
 
 func TestTokenService_GenerateToken(t *testing.T) {
 	store := &mockTokenStore{}
 	clock := mockClock{}
 
-	ts, err := NewTokenService(store, clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
 	require.NoError(t, err)
 
-	id := "user123"
+	id := testUserID
 	uniqueName := "testuser"
-	accessToken, refreshToken, err := ts.GenerateToken(context.Background(), id, uniqueName)
+	accessToken, refreshToken, err := ts.GenerateToken(context.Background(), id, uniqueName, RoleMember)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, accessToken, "accessToken should not be empty")
 	assert.NotEmpty(t, refreshToken, "refreshToken should not be empty")
 
 	// アクセストークンの検証
-	accessClaims, err := ts.ParseAccessToken(accessToken)
+	accessClaims, err := ts.ParseAccessToken(context.Background(), accessToken)
 	require.NoError(t, err, "Failed to parse access token")
 
 	assert.Equal(t, id, accessClaims.Sub, "Access token subject mismatch")
 	assert.Equal(t, uniqueName, accessClaims.Uname, "Access token unique name mismatch")
 	assert.Equal(t, testIssuer, accessClaims.Iss, "Access token issuer mismatch")
 	assert.Contains(t, accessClaims.Aud, testAudience, "Access token audience mismatch")
-	assert.Equal(t, clock.Now().Add(accessTokenExpire).Unix(), accessClaims.Exp.Unix(), "Access token expiration mismatch")
+	assert.Equal(t, clock.Now().Add(testTokenOptions.AccessTTL).Unix(), accessClaims.Exp.Unix(), "Access token expiration mismatch")
 	assert.Equal(t, clock.Now().Unix(), accessClaims.Iat.Unix(), "Access token issued at mismatch")
 	assert.NotEmpty(t, accessClaims.Jti, "Access token JTI should not be empty")
 
 	// リフレッシュトークンの検証
-	refreshClaims, err := ts.ParseRefreshToken(refreshToken)
+	refreshClaims, err := ts.ParseRefreshToken(context.Background(), refreshToken)
 	require.NoError(t, err, "Failed to parse refresh token")
 
 	assert.Equal(t, id, refreshClaims.Sub, "Refresh token subject mismatch")
 	assert.Equal(t, testIssuer, refreshClaims.Iss, "Refresh token issuer mismatch")
-	assert.Equal(t, clock.Now().Add(refreshTokenExpire).Unix(), refreshClaims.Exp.Unix(), "Refresh token expiration mismatch")
+	assert.Equal(t, clock.Now().Add(testTokenOptions.RefreshTTL).Unix(), refreshClaims.Exp.Unix(), "Refresh token expiration mismatch")
 	assert.NotEmpty(t, refreshClaims.Jti, "Refresh token JTI should not be empty")
 }
 
+func TestTokenService_GenerateToken_JTIを保存する(t *testing.T) {
+	clock := mockClock{}
+	store := newMemoryTokenStore(clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	id := testUserID
+	accessToken, refreshToken, err := ts.GenerateToken(context.Background(), id, "testuser", RoleMember)
+	require.NoError(t, err)
+	at, err := ts.ParseAccessToken(context.Background(), accessToken)
+	require.NoError(t, err)
+	rt, err := ts.ParseRefreshToken(context.Background(), refreshToken)
+	require.NoError(t, err)
+
+	// アクセストークンとリフレッシュトークンのJTIが、それぞれの有効期限に許容するずれを加えた時刻まで保存されること
+	assert.Len(t, store.saved, 2)
+	assert.Equal(t, at.Exp.Add(testTokenOptions.Leeway).Unix(), store.saved[id+":"+at.Jti].Unix())
+	assert.Equal(t, rt.Exp.Add(testTokenOptions.Leeway).Unix(), store.saved[id+":"+rt.Jti].Unix())
+
+	// 2回目のログインでも先のセッションが残ること
+	_, _, err = ts.GenerateToken(context.Background(), id, "testuser", RoleMember)
+	require.NoError(t, err)
+	assert.Len(t, store.saved, 4)
+	exists, err := store.ExistsJTI(context.Background(), id, at.Jti)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
 func TestTokenService_ParseAccessToken(t *testing.T) {
 	store := &mockTokenStore{}
 	clock := mockClock{}
-	ts, err := NewTokenService(store, clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
 	require.NoError(t, err)
 
-	id := "user123"
+	id := testUserID
 	uniqueName := "testuser"
-	accessToken, _, err := ts.GenerateToken(context.Background(), id, uniqueName)
+	accessToken, _, err := ts.GenerateToken(context.Background(), id, uniqueName, RoleMember)
 	require.NoError(t, err)
 
-	parsedToken, err := ts.ParseAccessToken(accessToken)
+	parsedToken, err := ts.ParseAccessToken(context.Background(), accessToken)
 	require.NoError(t, err, "Failed to parse access token")
 
 	assert.Equal(t, id, parsedToken.Sub, "Parsed token subject mismatch")
 	assert.Equal(t, uniqueName, parsedToken.Uname, "Parsed token unique name mismatch")
 	assert.Equal(t, testIssuer, parsedToken.Iss, "Parsed token issuer mismatch")
 	assert.Contains(t, parsedToken.Aud, testAudience, "Parsed token audience mismatch")
-	assert.Equal(t, clock.Now().Add(accessTokenExpire).Unix(), parsedToken.Exp.Unix(), "Parsed token expiration mismatch")
+	assert.Equal(t, clock.Now().Add(testTokenOptions.AccessTTL).Unix(), parsedToken.Exp.Unix(), "Parsed token expiration mismatch")
 	assert.Equal(t, clock.Now().Unix(), parsedToken.Iat.Unix(), "Parsed token issued at mismatch")
 	assert.NotEmpty(t, parsedToken.Jti, "Parsed token JTI should not be empty")
 
 	// 無効なトークンのテスト
 	invalidToken := "invalid.token.string"
-	parsedToken, err = ts.ParseAccessToken(invalidToken)
+	parsedToken, err = ts.ParseAccessToken(context.Background(), invalidToken)
 	assert.Error(t, err, "ParseAccessToken should return error for invalid token")
 	assert.Nil(t, parsedToken, "ParseAccessToken should return nil for invalid token")
 }
@@ -122,35 +287,347 @@ func TestTokenService_ParseAccessToken(t *testing.T) {
 func TestTokenService_ParseRefreshToken(t *testing.T) {
 	store := &mockTokenStore{}
 	clock := mockClock{}
-	ts, err := NewTokenService(store, clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
 	require.NoError(t, err)
 
-	id := "user123"
-	_, refreshToken, err := ts.GenerateToken(context.Background(), id, "testuser") // uniqueNameはリフレッシュトークンには含まれない
+	id := testUserID
+	_, refreshToken, err := ts.GenerateToken(context.Background(), id, "testuser", RoleMember) // uniqueNameはリフレッシュトークンには含まれない
 	require.NoError(t, err)
 
-	parsedToken, err := ts.ParseRefreshToken(refreshToken)
+	parsedToken, err := ts.ParseRefreshToken(context.Background(), refreshToken)
 	require.NoError(t, err, "Failed to parse access token")
 
 	assert.Equal(t, id, parsedToken.Sub, "Parsed token subject mismatch")
 	assert.Equal(t, testIssuer, parsedToken.Iss, "Parsed token issuer mismatch")
-	assert.Equal(t, clock.Now().Add(refreshTokenExpire).Unix(), parsedToken.Exp.Unix(), "Parsed token expiration mismatch")
+	assert.Equal(t, clock.Now().Add(testTokenOptions.RefreshTTL).Unix(), parsedToken.Exp.Unix(), "Parsed token expiration mismatch")
 	assert.NotEmpty(t, parsedToken.Jti, "Parsed token JTI should not be empty")
 
 	// 無効なトークンのテスト
 	invalidToken := "invalid.token.string"
-	parsedToken, err = ts.ParseRefreshToken(invalidToken)
+	parsedToken, err = ts.ParseRefreshToken(context.Background(), invalidToken)
 	assert.Error(t, err, "ParseRefreshToken should return error for invalid token")
 	assert.Nil(t, parsedToken, "ParseRefreshToken should return nil for invalid token")
 
 	// 異なるシークレットで署名されたトークンのテスト
-	otherSecretTS, err := NewTokenService(store, clock)
+	otherSecretTS, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
 	require.NoError(t, err)
-	otherSecretTS.refreshSecret = []byte("other_refresh_secret")
-	_, otherRefreshToken, err := otherSecretTS.GenerateToken(context.Background(), id, "testuser")
+	otherSecretTS.refreshSecret = []byte("other-refresh-secret-0123456789abcdef")
+	_, otherRefreshToken, err := otherSecretTS.GenerateToken(context.Background(), id, "testuser", RoleMember)
 	require.NoError(t, err)
 
-	parsedToken, err = ts.ParseRefreshToken(otherRefreshToken)
+	parsedToken, err = ts.ParseRefreshToken(context.Background(), otherRefreshToken)
 	assert.Error(t, err, "ParseRefreshToken should return error for token signed with different secret")
 	assert.Nil(t, parsedToken, "ParseRefreshToken should return nil for token signed with different secret")
 }
+
+func TestTokenService_RefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := newMemoryTokenStore(clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	id := testUserID
+	_, first, err := ts.GenerateToken(ctx, id, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	// 1回目のリフレッシュは成功し、同じファミリーの新しいトークンが発行される
+	clock.Advance(time.Hour)
+	verified, err := ts.VerifyRefreshToken(ctx, first)
+	require.NoError(t, err)
+	_, second, err := ts.RotateToken(ctx, verified, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	parsed, err := ts.ParseRefreshToken(ctx, second)
+	require.NoError(t, err)
+	assert.Equal(t, verified.Fam, parsed.Fam, "family should be inherited")
+	assert.NotEqual(t, verified.Jti, parsed.Jti, "jti should be rotated")
+	assert.Equal(t, clock.Now().Add(testTokenOptions.RefreshTTL).Unix(), parsed.Exp.Unix(), "expiration should slide")
+
+	// ローテーション後のトークンでさらにリフレッシュできる
+	clock.Advance(time.Hour)
+	verified, err = ts.VerifyRefreshToken(ctx, second)
+	require.NoError(t, err)
+	_, third, err := ts.RotateToken(ctx, verified, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	exists, err := store.ExistsJTI(ctx, id, parsed.Jti)
+	require.NoError(t, err)
+	assert.False(t, exists, "used refresh token should be removed from the store")
+
+	parsed, err = ts.ParseRefreshToken(ctx, third)
+	require.NoError(t, err)
+	exists, err = store.ExistsJTI(ctx, id, parsed.Jti)
+	require.NoError(t, err)
+	assert.True(t, exists, "latest refresh token should be stored")
+}
+
+func TestTokenService_RefreshTokenReuse(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := newMemoryTokenStore(clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	id := testUserID
+	_, stolen, err := ts.GenerateToken(ctx, id, "testuser", RoleMember)
+	require.NoError(t, err)
+	// 別の端末でのログインは別のファミリーになる
+	otherAccess, other, err := ts.GenerateToken(ctx, id, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	// 正規の利用者がリフレッシュする
+	clock.Advance(time.Minute)
+	verified, err := ts.VerifyRefreshToken(ctx, stolen)
+	require.NoError(t, err)
+	access, rotated, err := ts.RotateToken(ctx, verified, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	// 攻撃者が使用済みのトークンを提示すると再利用として拒否される
+	clock.Advance(time.Minute)
+	_, err = ts.VerifyRefreshToken(ctx, stolen)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	// ファミリーごと失効するため、ローテーション後のトークンも使えない
+	_, err = ts.VerifyRefreshToken(ctx, rotated)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, err = ts.ParseAccessToken(ctx, access)
+	assert.ErrorIs(t, err, ErrTokenRevoked, "access token in the revoked family should be removed")
+
+	// 別のファミリーには影響しない
+	_, err = ts.ParseAccessToken(ctx, otherAccess)
+	assert.NoError(t, err, "access token in another family should remain")
+	_, err = ts.VerifyRefreshToken(ctx, other)
+	assert.NoError(t, err)
+}
+
+// セッションの更新だけが失敗する TokenStore
+type failingTouchStore struct {
+	*memoryTokenStore
+	err error
+}
+
+func (s *failingTouchStore) TouchSession(ctx context.Context, id, family string, usedAt, exp time.Time) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.memoryTokenStore.TouchSession(ctx, id, family, usedAt, exp)
+}
+
+func TestTokenService_RotateToken_失敗しても同じトークンで再試行できる(t *testing.T) {
+	ctx := context.Background()
+	clock := mockClock{}
+	store := &failingTouchStore{memoryTokenStore: newMemoryTokenStore(clock), err: errors.New("connection refused")}
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	_, refreshToken, err := ts.GenerateToken(ctx, testUserID, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	verified, err := ts.VerifyRefreshToken(ctx, refreshToken)
+	require.NoError(t, err)
+	_, _, err = ts.RotateToken(ctx, verified, "testuser", RoleMember)
+	require.Error(t, err)
+
+	// 一時的な障害が解消すれば、同じトークンでリフレッシュできる
+	store.err = nil
+	verified, err = ts.VerifyRefreshToken(ctx, refreshToken)
+	require.NoError(t, err)
+	_, _, err = ts.RotateToken(ctx, verified, "testuser", RoleMember)
+	require.NoError(t, err)
+}
+
+func TestTokenService_RotateToken_同じトークンの同時利用は再利用として扱う(t *testing.T) {
+	ctx := context.Background()
+	clock := mockClock{}
+	ts, err := NewTokenService(newMemoryTokenStore(clock), newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	_, refreshToken, err := ts.GenerateToken(ctx, testUserID, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	first, err := ts.VerifyRefreshToken(ctx, refreshToken)
+	require.NoError(t, err)
+	second, err := ts.VerifyRefreshToken(ctx, refreshToken)
+	require.NoError(t, err)
+
+	_, rotated, err := ts.RotateToken(ctx, first, "testuser", RoleMember)
+	require.NoError(t, err)
+	_, _, err = ts.RotateToken(ctx, second, "testuser", RoleMember)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	// 先に発行したトークンもファミリーごと失効する
+	_, err = ts.VerifyRefreshToken(ctx, rotated)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+}
+
+func TestTokenService_RefreshTokenExpired(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := newMemoryTokenStore(clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	_, refreshToken, err := ts.GenerateToken(ctx, testUserID, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	// 許容するずれの範囲内であれば、有効期限を過ぎても使える
+	clock.Advance(testTokenOptions.RefreshTTL + time.Second)
+	_, err = ts.VerifyRefreshToken(ctx, refreshToken)
+	assert.NoError(t, err)
+
+	// 許容するずれを過ぎたリフレッシュトークンは、再利用ではなく期限切れとして扱う
+	clock.Advance(testTokenOptions.Leeway)
+	_, err = ts.VerifyRefreshToken(ctx, refreshToken)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+	assert.NotErrorIs(t, err, ErrRefreshTokenReused)
+}
+
+func TestTokenService_ParseAccessToken_許容するずれの範囲内は受け付ける(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ts, err := NewTokenService(newMemoryTokenStore(clock), newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	accessToken, _, err := ts.GenerateToken(ctx, testUserID, "testuser", RoleMember)
+	require.NoError(t, err)
+
+	// ストアの jti も許容するずれの間は残るため、失効とはみなさない
+	clock.Advance(testTokenOptions.AccessTTL + testTokenOptions.Leeway - time.Second)
+	_, err = ts.ParseAccessToken(ctx, accessToken)
+	assert.NoError(t, err)
+
+	clock.Advance(2 * time.Second)
+	_, err = ts.ParseAccessToken(ctx, accessToken)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestTokenService_数値のユーザーIDのトークンは受け付けない(t *testing.T) {
+	ctx := context.Background()
+	ts, err := NewTokenService(newMemoryTokenStore(mockClock{}), newTestKeySet(t, "test-key"), mockClock{}, testTokenOptions)
+	require.NoError(t, err)
+
+	// ユーザーIDが数値だった頃に発行したトークン
+	accessToken, refreshToken, err := ts.GenerateToken(ctx, "123", "testuser", RoleMember)
+	require.NoError(t, err)
+
+	_, err = ts.ParseAccessToken(ctx, accessToken)
+	assert.ErrorIs(t, err, ErrTokenMalformed)
+	_, err = ts.VerifyRefreshToken(ctx, refreshToken)
+	assert.ErrorIs(t, err, ErrTokenMalformed)
+	assert.NotErrorIs(t, err, ErrRefreshTokenReused)
+}
+
+// 検証条件ごとに異なる claims で署名したアクセストークン
+func signAccessToken(t *testing.T, ts *TokenService, claims accessClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = ts.keys.signing.ID
+	s, err := token.SignedString(ts.keys.signing.PrivateKey)
+	require.NoError(t, err)
+	return s
+}
+
+func TestTokenService_ParseAccessToken_厳密な検証(t *testing.T) {
+	ctx := context.Background()
+	clock := mockClock{}
+	ts, err := NewTokenService(&mockTokenStore{}, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	now := clock.Now()
+	valid := accessClaims{
+		Issuer:     testIssuer,
+		Subject:    testUserID,
+		Audience:   []string{testAudience},
+		ExpiresAt:  jwt.NewNumericDate(now.Add(time.Hour)),
+		NotBefore:  jwt.NewNumericDate(now),
+		IssuedAt:   jwt.NewNumericDate(now),
+		ID:         "jti",
+		UniqueName: "testuser",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *accessClaims)
+		want   error
+	}{
+		{"有効なトークン", func(c *accessClaims) {}, nil},
+		{"発行者が異なる", func(c *accessClaims) { c.Issuer = "other-issuer" }, ErrTokenInvalidIssuer},
+		{"対象者が異なる", func(c *accessClaims) { c.Audience = []string{"other-audience"} }, ErrTokenInvalidAudience},
+		{"対象者がない", func(c *accessClaims) { c.Audience = nil }, ErrTokenMalformed},
+		{"有効期限切れ", func(c *accessClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) }, ErrTokenExpired},
+		{"有効期限がない", func(c *accessClaims) { c.ExpiresAt = nil }, ErrTokenMalformed},
+		{"nbfが未来", func(c *accessClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) }, ErrTokenNotValidYet},
+		{"iatが未来", func(c *accessClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) }, ErrTokenNotValidYet},
+		{"ずれの範囲内のnbf", func(c *accessClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(testTokenOptions.Leeway / 2)) }, nil},
+		{"ずれの範囲内の有効期限切れ", func(c *accessClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-testTokenOptions.Leeway / 2)) }, nil},
+		{"jtiがない", func(c *accessClaims) { c.ID = "" }, ErrTokenMalformed},
+		{"subがユーザーIDでない", func(c *accessClaims) { c.Subject = "123" }, ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid
+			tt.modify(&claims)
+
+			parsed, err := ts.ParseAccessToken(ctx, signAccessToken(t, ts, claims))
+			if tt.want == nil {
+				require.NoError(t, err)
+				assert.Equal(t, testUserID, parsed.Sub)
+				return
+			}
+			assert.ErrorIs(t, err, tt.want)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+			assert.Nil(t, parsed)
+		})
+	}
+
+	t.Run("形式が不正", func(t *testing.T) {
+		parsed, err := ts.ParseAccessToken(ctx, "invalid.token.string")
+		assert.ErrorIs(t, err, ErrTokenMalformed)
+		assert.Nil(t, parsed)
+	})
+}
+
+func TestTokenService_ParseToken_失効したトークン(t *testing.T) {
+	ctx := context.Background()
+	clock := mockClock{}
+	store := newMemoryTokenStore(clock)
+	ts, err := NewTokenService(store, newTestKeySet(t, "test-key"), clock, testTokenOptions)
+	require.NoError(t, err)
+
+	accessToken, refreshToken, err := ts.GenerateToken(ctx, testUserID, "testuser", RoleMember)
+	require.NoError(t, err)
+	at, err := ts.ParseAccessToken(ctx, accessToken)
+	require.NoError(t, err)
+	rt, err := ts.ParseRefreshToken(ctx, refreshToken)
+	require.NoError(t, err)
+
+	// ストアから jti が削除されたトークンは、署名や有効期限が正しくても拒否する
+	_, err = store.DeleteJTI(ctx, at.Sub, at.Jti)
+	require.NoError(t, err)
+	_, err = store.DeleteJTI(ctx, rt.Sub, rt.Jti)
+	require.NoError(t, err)
+
+	_, err = ts.ParseAccessToken(ctx, accessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = ts.ParseRefreshToken(ctx, refreshToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestNewTokenService_設定が不足している場合はエラー(t *testing.T) {
+	cfg := testTokenOptions
+	cfg.RefreshSecret = nil
+	_, err := NewTokenService(&mockTokenStore{}, newTestKeySet(t, "test-key"), mockClock{}, cfg)
+	assert.Error(t, err)
+
+	// HS256 の出力長より短い共有鍵は受け付けない
+	cfg = testTokenOptions
+	cfg.RefreshSecret = make([]byte, MinRefreshSecretLength-1)
+	_, err = NewTokenService(&mockTokenStore{}, newTestKeySet(t, "test-key"), mockClock{}, cfg)
+	assert.Error(t, err)
+
+	cfg = testTokenOptions
+	cfg.AccessTTL = 0
+	_, err = NewTokenService(&mockTokenStore{}, newTestKeySet(t, "test-key"), mockClock{}, cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+// 見た目の紛らわしい文字列を判定する
+// Unicode の UTS #39 (Unicode Security Mechanisms) の skeleton をもとにしている
+package confusable
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// 文字を、見た目が同じ代表の文字列に置き換える表
+// UTS #39 の confusables.txt のうち、固有名に紛れ込みやすい文字を抜き出したもの
+// 置き換える前に小文字にするため、小文字だけを載せる。大文字が英字と紛らわしい文字も、小文字にした文字で載せる
+// 置き換えは1回だけ行うため、置き換え後の文字列はこの表で置き換わらないものにする
+var prototypes = map[rune]string{
+	// ASCII
+	'0': "o",
+	'1': "l",
+	'|': "l",
+	'd': "cl",
+	'm': "rn",
+
+	// キリル文字
+	'а': "a", 'е': "e", 'о': "o", 'р': "p", 'с': "c", 'у': "y",
+	'х': "x", 'ѕ': "s", 'і': "i", 'ј': "j", 'ԁ': "cl", 'һ': "h",
+	'ԛ': "q", 'ԝ': "w", 'ӏ': "l", 'ү': "y",
+	'в': "b", 'к': "k", 'м': "rn", 'н': "h", 'т': "t",
+
+	// ギリシャ文字
+	'α': "a", 'ο': "o", 'ν': "v", 'ρ': "p", 'ι': "i", 'υ': "u",
+	'κ': "k", 'χ': "x", 'β': "b", 'ε': "e", 'ζ': "z", 'η': "h",
+	'μ': "rn", 'τ': "t",
+
+	// ラテン文字の異体
+	'ı': "i", 'ɡ': "g", 'ℓ': "l",
+}
+
+// 大文字のときだけ別の英字と紛らわしい文字
+// 小文字にすると区別できるようになるため、小文字にする前に置き換える
+var uppercasePrototypes = map[rune]string{
+	// ラテン文字、キリル文字、ギリシャ文字の I は、小文字の l と見分けられない
+	'I': "l", 'І': "l", 'Ι': "l",
+}
+
+// 文字列の skeleton を返す
+// skeleton が一致する2つの文字列は、見た目で区別できない
+//
+// UTS #39 の skeleton とは次の点が異なる
+//   - 全角英数字などを置き換えるため、NFD の代わりに NFKD で分解する
+//   - 固有名は大文字と小文字を区別しないため、UTS #39 の大文字と小文字を区別しない比較にならい、置き換える前に小文字にそろえる
+//     ただし大文字の I は、小文字にすると l と区別できてしまうため、先に l に置き換える
+//
+// 大文字と小文字だけが異なる文字列は、skeleton が一致するとは限らない ("ADMIN" と "admin" など)
+// そのような文字列は、大文字と小文字を区別せずに比較して判定する
+func Skeleton(s string) string {
+	s = mapPrototypes(norm.NFKD.String(s), uppercasePrototypes)
+	s = strings.ToLower(s)
+	return norm.NFD.String(mapPrototypes(s, prototypes))
+}
+
+func mapPrototypes(s string, table map[rune]string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if p, ok := table[r]; ok {
+			b.WriteString(p)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// 2つの文字列の見た目が紛らわしいかを返す
+func Confusable(a, b string) bool {
+	return Skeleton(a) == Skeleton(b)
+}
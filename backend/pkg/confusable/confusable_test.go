@@ -0,0 +1,47 @@
+package confusable_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yDog-1/wodun/backend/pkg/confusable"
+)
+
+func TestConfusable(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"同じ文字列", "ydog", "ydog", true},
+		{"大文字と小文字", "yDog", "ydog", true},
+		{"キリル文字の大文字", "НОЅТ", "host", true},
+		{"キリル文字の d", "ԁog", "dog", true},
+		{"キリル文字の a", "аdmin", "admin", true},
+		{"ギリシャ文字の o", "ydοg", "ydog", true},
+		{"全角英字", "ｙｄｏｇ", "ydog", true},
+		{"数字の 0 と O", "yd0g", "ydog", true},
+		{"l と I と 1", "wodun_l", "wodun_1", true},
+		{"rn と m", "rnoderator", "moderator", true},
+		{"cl と d", "ycliog", "ydiog", true},
+		{"別の文字列", "ydog", "ycat", false},
+		{"i と l は区別する", "ydig", "ydlg", false},
+		{"大文字の I と l", "AIex", "Alex", true},
+		{"キリル文字の大文字の І と l", "АІех", "alex", true},
+		{"大文字の I と小文字の i は区別する", "AIex", "Aiex", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, confusable.Confusable(tt.a, tt.b))
+		})
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	assert.Equal(t, "yclog", confusable.Skeleton("yDog"))
+	assert.Equal(t, "aclrnln", confusable.Skeleton("АDMIN"))
+
+	// skeleton の skeleton は変わらない
+	s := confusable.Skeleton("0|1IDm_аԁмнвтκμβεζηІΙ")
+	assert.Equal(t, s, confusable.Skeleton(s))
+}
@@ -0,0 +1,174 @@
+// IDによる取得をまとめて1回のクエリにし、結果をリクエストの間だけ保持する
+// GraphQL で一覧の各行の関連を取得する場合の N+1 問題を避けるために使う
+package dataloader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// 最初のキーを受け付けてから、まとめて取得するまで待つ時間
+	DefaultWait = 2 * time.Millisecond
+	// 1回にまとめて取得するキーの数の上限
+	DefaultMaxBatch = 100
+)
+
+// キーに対応する値をまとめて取得する関数
+// 存在しないキーは結果に含めない
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// 値の一覧を取得する関数を BatchFunc にする
+// key は値からキーを取り出す関数
+func FromSlice[K comparable, V any](fetch func(ctx context.Context, keys []K) ([]V, error), key func(V) K) BatchFunc[K, V] {
+	return func(ctx context.Context, keys []K) (map[K]V, error) {
+		values, err := fetch(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		res := make(map[K]V, len(values))
+		for _, v := range values {
+			res[key(v)] = v
+		}
+		return res, nil
+	}
+}
+
+// 1つのリクエストの間に使う DataLoader
+// 同じキーは1回だけ取得し、取得した値はリクエストの間保持する
+type Loader[K comparable, V any] struct {
+	fetch BatchFunc[K, V]
+	// 存在しないキーに返すエラー
+	notFound error
+	wait     time.Duration
+	maxBatch int
+
+	mu    sync.Mutex
+	cache map[K]*result[V]
+	// 取得を待っているキー
+	pending *batch[K, V]
+}
+
+type result[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+type batch[K comparable, V any] struct {
+	// 取得に使う context
+	// 最初に Load した呼び出し元が取り消しても、同じバッチを待つ他の呼び出し元には結果を返せるよう、取り消しを引き継がない
+	ctx     context.Context
+	keys    []K
+	results []*result[V]
+	once    sync.Once
+}
+
+// Loader を生成する
+// notFound は fetch の結果に含まれなかったキーに返すエラー
+func New[K comparable, V any](fetch BatchFunc[K, V], notFound error) *Loader[K, V] {
+	return &Loader[K, V]{
+		fetch:    fetch,
+		notFound: notFound,
+		wait:     DefaultWait,
+		maxBatch: DefaultMaxBatch,
+		cache:    map[K]*result[V]{},
+	}
+}
+
+// キーに対応する値を返す
+// 同時に呼ばれた Load のキーは、まとめて1回の fetch で取得する
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	r, ok := l.cache[key]
+	if !ok {
+		r = &result[V]{done: make(chan struct{})}
+		l.cache[key] = r
+		l.enqueue(ctx, key, r)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// キーの一覧に対応する値を、キーと同じ順に返す
+// エラーはキーごとに返し、存在しないキーの位置には notFound が入る
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) ([]V, []error) {
+	values := make([]V, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values[i], errs[i] = l.Load(ctx, key)
+		}()
+	}
+	wg.Wait()
+	return values, errs
+}
+
+// 保持している値を捨て、次の Load で取得し直す
+// 値を更新した後に呼ぶ
+func (l *Loader[K, V]) Clear(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.cache, key)
+}
+
+// 取得を待つキーに加える。l.mu を取得した状態で呼ぶ
+func (l *Loader[K, V]) enqueue(ctx context.Context, key K, r *result[V]) {
+	b := l.pending
+	if b == nil {
+		b = &batch[K, V]{ctx: context.WithoutCancel(ctx)}
+		l.pending = b
+		time.AfterFunc(l.wait, func() { l.dispatch(b) })
+	}
+	b.keys = append(b.keys, key)
+	b.results = append(b.results, r)
+	if len(b.keys) >= l.maxBatch {
+		l.pending = nil
+		go l.dispatch(b)
+	}
+}
+
+// まとめたキーを取得し、待っている Load に結果を返す
+// 上限に達した場合と待ち時間が過ぎた場合の両方から呼ばれるが、取得は1回だけ行う
+func (l *Loader[K, V]) dispatch(b *batch[K, V]) {
+	b.once.Do(func() {
+		l.mu.Lock()
+		if l.pending == b {
+			l.pending = nil
+		}
+		l.mu.Unlock()
+
+		values, err := l.fetch(b.ctx, b.keys)
+		for i, key := range b.keys {
+			r := b.results[i]
+			switch v, ok := values[key]; {
+			case err != nil:
+				r.err = err
+			case !ok:
+				r.err = l.notFound
+			default:
+				r.value = v
+			}
+			close(r.done)
+		}
+		// 一時的なエラーや、取得の後に作られた値の可能性があるため、存在しなかった結果を含めて失敗した結果は保持しない
+		l.mu.Lock()
+		for i, key := range b.keys {
+			if b.results[i].err != nil && l.cache[key] == b.results[i] {
+				delete(l.cache, key)
+			}
+		}
+		l.mu.Unlock()
+	})
+}
@@ -0,0 +1,144 @@
+package dataloader_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/pkg/dataloader"
+)
+
+var errNotFound = errors.New("not found")
+
+// 取得したキーを記録する BatchFunc
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]int
+	err     error
+}
+
+func (r *recorder) fetch(ctx context.Context, keys []int) (map[int]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sorted := append([]int(nil), keys...)
+	sort.Ints(sorted)
+	r.batches = append(r.batches, sorted)
+	if r.err != nil {
+		return nil, r.err
+	}
+	res := map[int]string{}
+	for _, k := range keys {
+		// 負のキーは存在しない
+		if k >= 0 {
+			res[k] = fmt.Sprint("value", k)
+		}
+	}
+	return res, nil
+}
+
+func TestLoader_同時に呼ばれたキーをまとめて取得する(t *testing.T) {
+	ctx := context.Background()
+	r := &recorder{}
+	l := dataloader.New(r.fetch, errNotFound)
+
+	values, errs := l.LoadMany(ctx, []int{3, 1, 2, 1})
+	assert.Equal(t, []string{"value3", "value1", "value2", "value1"}, values)
+	assert.Equal(t, []error{nil, nil, nil, nil}, errs)
+	assert.Equal(t, [][]int{{1, 2, 3}}, r.batches)
+
+	// 取得済みのキーは取得し直さない
+	v, err := l.Load(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "value2", v)
+	assert.Len(t, r.batches, 1)
+
+	// Clear したキーは取得し直す
+	l.Clear(2)
+	_, err = l.Load(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1, 2, 3}, {2}}, r.batches)
+}
+
+func TestLoader_存在しないキーにはnotFoundを返す(t *testing.T) {
+	r := &recorder{}
+	l := dataloader.New(r.fetch, errNotFound)
+
+	_, errs := l.LoadMany(context.Background(), []int{1, -1})
+	assert.NoError(t, errs[0])
+	assert.ErrorIs(t, errs[1], errNotFound)
+
+	// 存在しなかった結果は保持せず、次の Load で取得し直す
+	_, err := l.Load(context.Background(), -1)
+	assert.ErrorIs(t, err, errNotFound)
+	assert.Equal(t, [][]int{{-1, 1}, {-1}}, r.batches)
+}
+
+func TestLoader_最初の呼び出し元が取り消しても他の呼び出し元には結果を返す(t *testing.T) {
+	var fetchCtx context.Context
+	l := dataloader.New(func(ctx context.Context, keys []int) (map[int]string, error) {
+		fetchCtx = ctx
+		return map[int]string{1: "value1"}, nil
+	}, errNotFound)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cancel()
+		_, err := l.Load(canceled, 1)
+		assert.ErrorIs(t, err, context.Canceled)
+	}()
+	wg.Wait()
+
+	v, err := l.Load(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "value1", v)
+	assert.NoError(t, fetchCtx.Err())
+}
+
+func TestLoader_上限を超えるキーは分けて取得する(t *testing.T) {
+	r := &recorder{}
+	l := dataloader.New(r.fetch, errNotFound)
+
+	keys := make([]int, dataloader.DefaultMaxBatch+1)
+	for i := range keys {
+		keys[i] = i
+	}
+	_, errs := l.LoadMany(context.Background(), keys)
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	require.Len(t, r.batches, 2)
+	assert.Len(t, append(r.batches[0], r.batches[1]...), len(keys))
+}
+
+func TestLoader_取得に失敗した結果は保持しない(t *testing.T) {
+	ctx := context.Background()
+	errFetch := errors.New("connection refused")
+	r := &recorder{err: errFetch}
+	l := dataloader.New(r.fetch, errNotFound)
+
+	_, err := l.Load(ctx, 1)
+	assert.ErrorIs(t, err, errFetch)
+
+	r.err = nil
+	v, err := l.Load(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "value1", v)
+}
+
+func TestFromSlice(t *testing.T) {
+	fetch := dataloader.FromSlice(func(ctx context.Context, keys []string) ([]string, error) {
+		return []string{"a:1", "b:2"}, nil
+	}, func(v string) string { return v[:1] })
+
+	res, err := fetch(context.Background(), []string{"a", "b", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "a:1", "b": "b:2"}, res)
+}
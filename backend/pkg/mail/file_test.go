@@ -0,0 +1,42 @@
+package mail_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	wmail "github.com/yDog-1/wodun/backend/pkg/mail"
+)
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m, err := wmail.NewFileMailer(dir, "noreply@example.com")
+	require.NoError(t, err)
+
+	err = m.Send(context.Background(), wmail.Message{
+		To:      "ydog@example.com",
+		Subject: "ログインリンク",
+		Body:    "本文",
+	})
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, ".eml", filepath.Ext(files[0].Name()))
+
+	b, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "To: ydog@example.com\r\n")
+	assert.Contains(t, string(b), "From: noreply@example.com\r\n")
+}
+
+func TestMemoryMailer_Send(t *testing.T) {
+	m := wmail.NewMemoryMailer()
+	msg := wmail.Message{To: "ydog@example.com", Subject: "件名", Body: "本文"}
+	require.NoError(t, m.Send(context.Background(), msg))
+	assert.Equal(t, []wmail.Message{msg}, m.Sent())
+}
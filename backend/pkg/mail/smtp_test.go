@@ -0,0 +1,127 @@
+package mail_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	wmail "github.com/yDog-1/wodun/backend/pkg/mail"
+)
+
+// テスト用の最小限のSMTPサーバー
+type fakeSMTPServer struct {
+	ln       net.Listener
+	from     string
+	rcpt     []string
+	data     string
+	received chan struct{}
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSMTPServer{ln: ln, received: make(chan struct{})}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTPServer) addr() (host, port string) {
+	host, port, _ = net.SplitHostPort(s.ln.Addr().String())
+	return host, port
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP fake")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			_ = tp.PrintfLine("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			_ = tp.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpt = append(s.rcpt, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			_ = tp.PrintfLine("250 OK")
+		case cmd == "DATA":
+			_ = tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			b, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(b)
+			_ = tp.PrintfLine("250 OK")
+			close(s.received)
+		case cmd == "QUIT":
+			_ = tp.PrintfLine("221 Bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPMailer_Send(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	host, port := server.addr()
+
+	m, err := wmail.NewSMTPMailer(wmail.SMTPConfig{
+		Host: host,
+		Port: port,
+		From: "noreply@example.com",
+	})
+	require.NoError(t, err)
+
+	err = m.Send(context.Background(), wmail.Message{
+		To:      "ydog@example.com",
+		Subject: "ログインリンク",
+		Body:    "以下のリンクからログインしてください\nhttps://example.com/login?token=abc",
+	})
+	require.NoError(t, err)
+	<-server.received
+
+	assert.Equal(t, "noreply@example.com", server.from)
+	assert.Equal(t, []string{"ydog@example.com"}, server.rcpt)
+
+	// 受信したメッセージを解析する
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(server.data)))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "ログインリンク", subject)
+	assert.Equal(t, "ydog@example.com", msg.Header.Get("To"))
+
+	body, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, msg.Body))
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "https://example.com/login?token=abc")
+}
+
+func TestNewSMTPMailer_設定が不足している(t *testing.T) {
+	_, err := wmail.NewSMTPMailer(wmail.SMTPConfig{Port: "25", From: "noreply@example.com"})
+	assert.Error(t, err)
+	_, err = wmail.NewSMTPMailer(wmail.SMTPConfig{Host: "localhost", From: "noreply@example.com"})
+	assert.Error(t, err)
+	_, err = wmail.NewSMTPMailer(wmail.SMTPConfig{Host: "localhost", Port: "25"})
+	assert.Error(t, err)
+}
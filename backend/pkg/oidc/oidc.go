@@ -0,0 +1,120 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Google の OpenID Connect の issuer
+const GoogleIssuer = "https://accounts.google.com"
+
+var (
+	// トークンレスポンスに ID トークンが含まれていない
+	ErrMissingIDToken = errors.New("oidc: id_token is missing in token response")
+	// ID トークンの nonce が認可リクエストで送ったものと一致しない
+	ErrNonceMismatch = errors.New("oidc: nonce mismatch")
+)
+
+// OpenID Connect プロバイダーの設定
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// 省略した場合は openid, email, profile を要求する
+	Scopes []string
+}
+
+// 検証済みの ID トークンから取り出した情報
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// 認可コードフロー + PKCE で ID トークンを取得して検証する
+type Provider struct {
+	oauth2   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// Provider を生成する
+// issuer のディスカバリードキュメントからエンドポイントと JWKS の場所を取得する
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	if cfg.ClientID == "" {
+		return nil, errors.New("oidc client id is not set")
+	}
+	if cfg.RedirectURL == "" {
+		return nil, errors.New("oidc redirect url is not set")
+	}
+	p, err := gooidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider: %w", err)
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{gooidc.ScopeOpenID, "email", "profile"}
+	}
+	return &Provider{
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     p.Endpoint(),
+			Scopes:       scopes,
+		},
+		// issuer, audience, 有効期限, 署名 (JWKS) を検証する
+		verifier: p.Verifier(&gooidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// 認可エンドポイントの URL を生成する
+// verifier は PKCE のコードベリファイアで、S256 のチャレンジとして送る
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth2.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// 認可コードをトークンに交換し、ID トークンを検証して内容を返す
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok || raw == "" {
+		return nil, ErrMissingIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return nil, ErrNonceMismatch
+	}
+
+	var c struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&c); err != nil {
+		return nil, err
+	}
+	return &Claims{
+		Subject:       idToken.Subject,
+		Email:         c.Email,
+		EmailVerified: c.EmailVerified,
+		Name:          c.Name,
+	}, nil
+}
+
+// PKCE のコードベリファイアを生成する
+func GenerateVerifier() string {
+	return oauth2.GenerateVerifier()
+}
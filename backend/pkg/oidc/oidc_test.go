@@ -0,0 +1,220 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/pkg/oidc"
+)
+
+const (
+	testClientID    = "test-client"
+	testRedirectURL = "https://wodun.example.com/auth/callback"
+)
+
+// httptest で動かすテスト用の OpenID Connect プロバイダー
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// 認可コードごとの PKCE チャレンジと nonce
+	codes map[string]authRequest
+	// ID トークンに含めるクレームを上書きする
+	override jwt.MapClaims
+	// ID トークンの署名に使う鍵を差し替える
+	signingKey *rsa.PrivateKey
+}
+
+type authRequest struct {
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	m := &mockProvider{t: t, key: key, codes: map[string]authRequest{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// 認可エンドポイントの代わりに、認可 URL の内容から認可コードを払い出す
+func (m *mockProvider) authorize(authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	require.NoError(m.t, err)
+	q := u.Query()
+	assert.Equal(m.t, "S256", q.Get("code_challenge_method"))
+	assert.Equal(m.t, testClientID, q.Get("client_id"))
+	code = "code-" + q.Get("state")
+	m.codes[code] = authRequest{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	return code, q.Get("state")
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	require.NoError(m.t, r.ParseForm())
+	req, ok := m.codes[r.PostForm.Get("code")]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	delete(m.codes, r.PostForm.Get("code"))
+
+	// PKCE のコードベリファイアがチャレンジと一致するか検証する
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"sub":            "google-sub-123",
+		"aud":            testClientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          req.nonce,
+		"email":          "ydog@example.com",
+		"email_verified": true,
+		"name":           "yDog",
+	}
+	for k, v := range m.override {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	key := m.key
+	if m.signingKey != nil {
+		key = m.signingKey
+	}
+	idToken, err := token.SignedString(key)
+	require.NoError(m.t, err)
+
+	writeJSON(w, map[string]any{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func newProvider(t *testing.T, m *mockProvider) *oidc.Provider {
+	t.Helper()
+	p, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:      m.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	})
+	require.NoError(t, err)
+	return p
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	m := newMockProvider(t)
+	p := newProvider(t, m)
+
+	verifier := oidc.GenerateVerifier()
+	code, state := m.authorize(p.AuthCodeURL("state-1", "nonce-1", verifier))
+	assert.Equal(t, "state-1", state)
+
+	claims, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, "google-sub-123", claims.Subject)
+	assert.Equal(t, "ydog@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, "yDog", claims.Name)
+}
+
+func TestProvider_Exchange_PKCEが一致しない(t *testing.T) {
+	m := newMockProvider(t)
+	p := newProvider(t, m)
+
+	code, _ := m.authorize(p.AuthCodeURL("state-1", "nonce-1", oidc.GenerateVerifier()))
+	_, err := p.Exchange(context.Background(), code, oidc.GenerateVerifier(), "nonce-1")
+	assert.Error(t, err)
+}
+
+func TestProvider_Exchange_nonceが一致しない(t *testing.T) {
+	m := newMockProvider(t)
+	p := newProvider(t, m)
+
+	verifier := oidc.GenerateVerifier()
+	code, _ := m.authorize(p.AuthCodeURL("state-1", "nonce-1", verifier))
+	_, err := p.Exchange(context.Background(), code, verifier, "other-nonce")
+	assert.ErrorIs(t, err, oidc.ErrNonceMismatch)
+}
+
+func TestProvider_Exchange_不正なIDトークン(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		override   jwt.MapClaims
+		signingKey *rsa.PrivateKey
+	}{
+		{name: "issuerが異なる", override: jwt.MapClaims{"iss": "https://evil.example.com"}},
+		{name: "audienceが異なる", override: jwt.MapClaims{"aud": "other-client"}},
+		{name: "有効期限切れ", override: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{name: "JWKSにない鍵で署名されている", signingKey: otherKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			m.override = tt.override
+			m.signingKey = tt.signingKey
+			p := newProvider(t, m)
+
+			verifier := oidc.GenerateVerifier()
+			code, _ := m.authorize(p.AuthCodeURL("state-1", "nonce-1", verifier))
+			_, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Relay の Cursor Connections に沿ったページ分割
+// OFFSET は使わず、並び順のキーより後ろの行を取得する (keyset pagination)
+package pagination
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+)
+
+const (
+	// first を省略した場合に返す件数
+	DefaultFirst = 20
+	// first に指定できる件数の上限
+	MaxFirst = 100
+)
+
+// カーソルの形式の版。形式を変えた場合に古いカーソルを拒否するために付ける
+const cursorPrefix = "v1:"
+
+var (
+	// first が範囲外
+	ErrInvalidFirst = apperr.Validation(apperr.Field("first", "must be between 0 and 100"))
+	// after がこのサーバーの返したカーソルではない
+	ErrInvalidCursor = apperr.Validation(apperr.Field("after", "invalid cursor"))
+)
+
+type PageInfo struct {
+	HasNextPage     bool
+	HasPreviousPage bool
+	StartCursor     *string
+	EndCursor       *string
+}
+
+type Edge[T any] struct {
+	Node   T
+	Cursor string
+}
+
+type Connection[T any] struct {
+	Edges    []*Edge[T]
+	PageInfo *PageInfo
+}
+
+// 取得するページ
+type Page struct {
+	// 取得する件数
+	First int
+	// このキーより後ろの行を取得する。空文字列の場合は先頭から取得する
+	After string
+}
+
+// 次のページがあるかを判定するため、取得する行の数
+// リポジトリは Limit 件まで取得し、NewConnection に渡す
+func (p Page) Limit() int {
+	return p.First + 1
+}
+
+// GraphQL の引数からページを作る
+func NewPage(first *int32, after *string) (Page, error) {
+	p := Page{First: DefaultFirst}
+	if first != nil {
+		if *first < 0 || *first > MaxFirst {
+			return Page{}, ErrInvalidFirst
+		}
+		p.First = int(*first)
+	}
+	if after != nil {
+		key, err := DecodeCursor(*after)
+		if err != nil {
+			return Page{}, err
+		}
+		p.After = key
+	}
+	return p, nil
+}
+
+// 並び順のキーを、クライアントには中身のわからないカーソルにする
+func EncodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + key))
+}
+
+// カーソルを並び順のキーに戻す
+func DecodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", ErrInvalidCursor.Wrap(err)
+	}
+	key, ok := strings.CutPrefix(string(b), cursorPrefix)
+	if !ok || key == "" {
+		return "", ErrInvalidCursor
+	}
+	return key, nil
+}
+
+// Page.Limit 件まで取得した行から Connection を作る
+// key は行の並び順のキーで、カーソルになる
+func NewConnection[T any](rows []T, page Page, key func(T) string) *Connection[T] {
+	hasNext := len(rows) > page.First
+	if hasNext {
+		rows = rows[:page.First]
+	}
+	edges := make([]*Edge[T], len(rows))
+	for i, row := range rows {
+		edges[i] = &Edge[T]{Node: row, Cursor: EncodeCursor(key(row))}
+	}
+	info := &PageInfo{
+		HasNextPage: hasNext,
+		// after より前の行は数えず、after を指定した場合は前のページがあるとみなす
+		HasPreviousPage: page.After != "",
+	}
+	if len(edges) > 0 {
+		info.StartCursor = &edges[0].Cursor
+		info.EndCursor = &edges[len(edges)-1].Cursor
+	}
+	return &Connection[T]{Edges: edges, PageInfo: info}
+}
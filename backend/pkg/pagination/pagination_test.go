@@ -0,0 +1,75 @@
+package pagination_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/pkg/pagination"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestCursor(t *testing.T) {
+	cursor := pagination.EncodeCursor("0192f5b0-6c1e-7a3b-8c4d-5e6f7a8b9c0d")
+	key, err := pagination.DecodeCursor(cursor)
+	require.NoError(t, err)
+	assert.Equal(t, "0192f5b0-6c1e-7a3b-8c4d-5e6f7a8b9c0d", key)
+
+	// このサーバーが返した形式でないカーソルは拒否する
+	for _, cursor := range []string{"", "!!", "MTIz", pagination.EncodeCursor("")} {
+		_, err := pagination.DecodeCursor(cursor)
+		assert.ErrorIs(t, err, pagination.ErrInvalidCursor, cursor)
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	page, err := pagination.NewPage(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, pagination.Page{First: pagination.DefaultFirst}, page)
+
+	page, err = pagination.NewPage(ptr[int32](5), ptr(pagination.EncodeCursor("b")))
+	require.NoError(t, err)
+	assert.Equal(t, pagination.Page{First: 5, After: "b"}, page)
+	assert.Equal(t, 6, page.Limit())
+
+	for _, first := range []int32{-1, pagination.MaxFirst + 1} {
+		_, err := pagination.NewPage(&first, nil)
+		assert.ErrorIs(t, err, pagination.ErrInvalidFirst)
+	}
+	_, err = pagination.NewPage(nil, ptr("invalid"))
+	assert.ErrorIs(t, err, pagination.ErrInvalidCursor)
+}
+
+func TestNewConnection(t *testing.T) {
+	key := func(n int) string { return strconv.Itoa(n) }
+
+	t.Run("次のページがある", func(t *testing.T) {
+		conn := pagination.NewConnection([]int{1, 2, 3}, pagination.Page{First: 2}, key)
+		require.Len(t, conn.Edges, 2)
+		assert.Equal(t, 1, conn.Edges[0].Node)
+		assert.Equal(t, 2, conn.Edges[1].Node)
+		assert.True(t, conn.PageInfo.HasNextPage)
+		assert.False(t, conn.PageInfo.HasPreviousPage)
+		assert.Equal(t, pagination.EncodeCursor("1"), *conn.PageInfo.StartCursor)
+		assert.Equal(t, pagination.EncodeCursor("2"), *conn.PageInfo.EndCursor)
+	})
+
+	t.Run("最後のページ", func(t *testing.T) {
+		conn := pagination.NewConnection([]int{3}, pagination.Page{First: 2, After: "2"}, key)
+		require.Len(t, conn.Edges, 1)
+		assert.False(t, conn.PageInfo.HasNextPage)
+		assert.True(t, conn.PageInfo.HasPreviousPage)
+	})
+
+	t.Run("空のページ", func(t *testing.T) {
+		conn := pagination.NewConnection(nil, pagination.Page{First: 2}, key)
+		assert.Empty(t, conn.Edges)
+		assert.False(t, conn.PageInfo.HasNextPage)
+		assert.Nil(t, conn.PageInfo.StartCursor)
+		assert.Nil(t, conn.PageInfo.EndCursor)
+	})
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// context にクライアントの IP アドレスを設定する
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// context からクライアントの IP アドレスを取得する
+func ClientIPFrom(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok && ip != ""
+}
+
+// リクエストの送信元 IP アドレスを context に設定するミドルウェア
+// trustedProxies は手前にあるリバースプロキシの数で、0 の場合は X-Forwarded-For を無視する
+// X-Forwarded-For の左側はクライアントが自由に書けるため、各プロキシが右端に追記したアドレスだけを使う
+// プロキシの数より多く設定すると、クライアントが IP アドレスを偽装できる
+func ClientIPMiddleware(trustedProxies int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := remoteIP(r.RemoteAddr)
+			if forwarded := forwardedIP(r.Header.Values("X-Forwarded-For"), trustedProxies); forwarded != "" {
+				ip = forwarded
+			}
+			next.ServeHTTP(w, r.WithContext(WithClientIP(r.Context(), ip)))
+		})
+	}
+}
+
+// 右端から trustedProxies 番目のアドレスを返す
+// 最も近いプロキシが右端に送信元を追記するため、右端から数えたアドレスは信頼したプロキシが書いたもの
+// 項目が足りない場合は、信頼したプロキシを経由していないため空文字列を返す
+func forwardedIP(headers []string, trustedProxies int) string {
+	if trustedProxies <= 0 {
+		return ""
+	}
+	var entries []string
+	for _, h := range headers {
+		for _, e := range strings.Split(h, ",") {
+			entries = append(entries, strings.TrimSpace(e))
+		}
+	}
+	if len(entries) < trustedProxies {
+		return ""
+	}
+	return entries[len(entries)-trustedProxies]
+}
+
+// "host:port" からホスト部分を取り出す
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIPMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies int
+		forwarded      string
+		want           string
+	}{
+		{"送信元のアドレスを使う", 0, "", "192.0.2.1"},
+		{"プロキシを信頼しない場合はヘッダーを無視する", 0, "198.51.100.7", "192.0.2.1"},
+		{"プロキシが1つの場合は右端のアドレスを使う", 1, "198.51.100.7", "198.51.100.7"},
+		{"クライアントが書いた左側のアドレスは使わない", 1, "203.0.113.99, 198.51.100.7", "198.51.100.7"},
+		{"プロキシが2つの場合は右端から2番目のアドレスを使う", 2, "203.0.113.99, 198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		{"プロキシの数より項目が少なければ送信元のアドレスを使う", 2, "198.51.100.7", "192.0.2.1"},
+		{"ヘッダーがなければ送信元のアドレスを使う", 1, "", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := ClientIPMiddleware(tt.trustedProxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = ClientIPFrom(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/query", nil)
+			req.RemoteAddr = "192.0.2.1:54321"
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
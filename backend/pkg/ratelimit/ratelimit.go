@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// スライディングウィンドウで回数を数える Lua スクリプト
+// 判定と記録を原子的に行うため、同時に呼び出されても上限を超えない
+// 時刻には Redis サーバーの時刻を使い、アプリケーションサーバー間の時刻のずれの影響を受けない
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local member = ARGV[3]
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+if count < limit then
+	redis.call('ZADD', key, now, member)
+	redis.call('PEXPIRE', key, window)
+	return {1, limit - count - 1, 0}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {0, 0, tonumber(oldest[2]) + window - now}
+`)
+
+// スライディングウィンドウで費用の合計を数える Lua スクリプト
+// 記録ごとの費用は、メンバーの末尾に ":<費用>" として持たせる
+// 費用の合計は KEYS[2] に持ち、記録するときに足して、期限の切れた記録を消すときに引く
+// 各記録は消すときに1回だけ読むため、呼び出しごとに全ての記録を読まない
+// 拒否した場合は、最も古い記録の期限が切れるまでの時間を返す。その時点で cost が収まるとは限らない
+var weightedWindow = redis.NewScript(`
+local key = KEYS[1]
+local total = KEYS[2]
+local cost = tonumber(ARGV[1])
+local budget = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local member = ARGV[4]
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local expired = redis.call('ZRANGEBYSCORE', key, '-inf', now - window)
+if #expired > 0 then
+	local freed = 0
+	for i = 1, #expired do
+		freed = freed + tonumber(string.match(expired[i], ':(%d+)$'))
+	end
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	redis.call('DECRBY', total, freed)
+end
+
+local used = tonumber(redis.call('GET', total) or 0)
+if used + cost <= budget then
+	redis.call('ZADD', key, now, member .. ':' .. cost)
+	redis.call('INCRBY', total, cost)
+	redis.call('PEXPIRE', key, window)
+	redis.call('PEXPIRE', total, window)
+	return {1, budget - used - cost, 0}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if #oldest == 0 then
+	return {0, budget - used, window}
+end
+return {0, budget - used, tonumber(oldest[2]) + window - now}
+`)
+
+// 判定の結果
+type Result struct {
+	Allowed bool
+	// ウィンドウ内で残っている回数。Spend の場合は残っている予算
+	Remaining int
+	// 拒否された場合に、次に許可されるまでの時間
+	RetryAfter time.Duration
+}
+
+// Redis に記録した呼び出し回数で流量を制限する
+type Limiter struct {
+	rdb *redis.Client
+}
+
+func New(rdb *redis.Client) *Limiter {
+	return &Limiter{rdb}
+}
+
+// 直近 window の間に key で許可した回数が limit 未満であれば許可し、回数に数える
+// 拒否した呼び出しは回数に数えない
+func (l *Limiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	if key == "" {
+		return Result{}, errors.New("key must not be empty")
+	}
+	if limit <= 0 || window < time.Millisecond {
+		return Result{}, fmt.Errorf("invalid limit %d per %s", limit, window)
+	}
+	res, err := slidingWindow.Run(ctx, l.rdb,
+		[]string{"ratelimit:" + key},
+		limit, window.Milliseconds(), uuid.New().String(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to run rate limit script: %w", err)
+	}
+	return Result{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
+
+// 直近 window の間に key で使った費用と cost の合計が budget 以下であれば許可し、cost を使ったものとして数える
+// 拒否した呼び出しの費用は数えない
+// 拒否した場合の RetryAfter は、予算が戻り始めるまでの時間
+func (l *Limiter) Spend(ctx context.Context, key string, cost, budget int, window time.Duration) (Result, error) {
+	if key == "" {
+		return Result{}, errors.New("key must not be empty")
+	}
+	if cost < 0 || budget <= 0 || window < time.Millisecond {
+		return Result{}, fmt.Errorf("invalid cost %d for budget %d per %s", cost, budget, window)
+	}
+	res, err := weightedWindow.Run(ctx, l.rdb,
+		[]string{"ratelimit:" + key, "ratelimit:" + key + ":total"},
+		cost, budget, window.Milliseconds(), uuid.New().String(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to run cost budget script: %w", err)
+	}
+	return Result{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package ratelimit_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/pkg/ratelimit"
+	"github.com/yDog-1/wodun/backend/pkg/testing/container"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	l := ratelimit.New(client)
+
+	// 上限までは許可され、残りの回数が減っていく
+	for i := 2; i >= 0; i-- {
+		res, err := l.Allow(ctx, "test:user123", 3, 2*time.Second)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	// 上限を超えると拒否され、再試行までの時間が返る
+	res, err := l.Allow(ctx, "test:user123", 3, 2*time.Second)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Greater(t, res.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(t, res.RetryAfter, 2*time.Second)
+
+	// キーが異なれば別に数える
+	res, err = l.Allow(ctx, "test:user456", 3, 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	// ウィンドウが過ぎると再び許可される
+	time.Sleep(2100 * time.Millisecond)
+	res, err = l.Allow(ctx, "test:user123", 3, 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestLimiter_Allow_同時に呼び出しても上限を超えない(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	l := ratelimit.New(client)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := l.Allow(ctx, "test:concurrent", 5, time.Minute)
+			assert.NoError(t, err)
+			if res.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 5, allowed)
+}
+
+func TestLimiter_Spend(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	l := ratelimit.New(client)
+
+	// 予算の範囲内は許可され、使った費用だけ残りの予算が減る
+	res, err := l.Spend(ctx, "test:cost", 60, 100, 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 40, res.Remaining)
+
+	res, err = l.Spend(ctx, "test:cost", 40, 100, 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// 予算を超える費用は拒否され、数えられない
+	res, err = l.Spend(ctx, "test:cost", 1, 100, 2*time.Second)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Greater(t, res.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(t, res.RetryAfter, 2*time.Second)
+
+	// ウィンドウが過ぎると予算が戻る
+	time.Sleep(2100 * time.Millisecond)
+	res, err = l.Spend(ctx, "test:cost", 100, 100, 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
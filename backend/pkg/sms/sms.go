@@ -0,0 +1,62 @@
+package sms
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// 送信するSMS
+type Message struct {
+	// E.164 形式の電話番号
+	To   string
+	Body string
+}
+
+// SMSを送信する
+type SMSSender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// 送信したSMSをメモリ上に記録する SMSSender
+// テストで送信内容を確認するために用いる
+type MemorySender struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+// 送信したSMSを古い順に返す
+func (s *MemorySender) Sent() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.sent...)
+}
+
+// SMSを送信せずにログへ出力する SMSSender
+// 開発環境で内容を確認するために用いる
+type LogSender struct {
+	logger *log.Logger
+}
+
+func NewLogSender(logger *log.Logger) *LogSender {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &LogSender{logger}
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	s.logger.Printf("sms to %s: %s", msg.To, msg.Body)
+	return nil
+}
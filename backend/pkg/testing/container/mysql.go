@@ -10,6 +10,8 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/mysql"
+	// Go で書いたマイグレーションを登録する
+	_ "github.com/yDog-1/wodun/backend/sql/migrations"
 )
 
 type mySQLcontainerInput struct {
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yDog-1/wodun/backend/graph/model"
+)
+
+type emailChangeRepository struct {
+	changes pendingChangeStore
+}
+
+func NewEmailChangeRepository(store *redis.Client) *emailChangeRepository {
+	return &emailChangeRepository{pendingChangeStore{store: store, prefix: "emailchange"}}
+}
+
+// 確認待ちの変更を保存し、change.ExpiresAt に失効させる
+func (r *emailChangeRepository) SaveEmailChange(ctx context.Context, userID, hash string, change *model.PendingEmailChange) error {
+	return r.changes.save(ctx, userID, hash, change.Email, change.ExpiresAt)
+}
+
+func (r *emailChangeRepository) GetEmailChange(ctx context.Context, userID string) (*model.PendingEmailChange, bool, error) {
+	c, ok, err := r.changes.get(ctx, r.changes.store, userID)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return &model.PendingEmailChange{Email: c.Value, ExpiresAt: c.ExpiresAt}, true, nil
+}
+
+// 確認リンクのトークンのハッシュから確認待ちの変更を取り出して削除する
+func (r *emailChangeRepository) ConsumeEmailChange(ctx context.Context, hash string) (string, *model.PendingEmailChange, bool, error) {
+	userID, c, ok, err := r.changes.consume(ctx, hash)
+	if err != nil || !ok {
+		return "", nil, false, err
+	}
+	return userID, &model.PendingEmailChange{Email: c.Value, ExpiresAt: c.ExpiresAt}, true, nil
+}
+
+func (r *emailChangeRepository) DeleteEmailChange(ctx context.Context, userID string) error {
+	return r.changes.delete(ctx, userID)
+}
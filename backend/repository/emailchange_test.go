@@ -0,0 +1,96 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/testing/container"
+	"github.com/yDog-1/wodun/backend/repository"
+)
+
+func TestEmailChangeRepository(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	repo := repository.NewEmailChangeRepository(client)
+	expiresAt := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	err := repo.SaveEmailChange(ctx, "1", "hash1", &model.PendingEmailChange{Email: "old@example.com", ExpiresAt: expiresAt})
+	require.NoError(t, err)
+	// 新しい申請で置き換えると、古い確認リンクは使えなくなる
+	err = repo.SaveEmailChange(ctx, "1", "hash2", &model.PendingEmailChange{Email: "new@example.com", ExpiresAt: expiresAt})
+	require.NoError(t, err)
+
+	pending, ok, err := repo.GetEmailChange(ctx, "1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "new@example.com", pending.Email)
+	assert.True(t, expiresAt.Equal(pending.ExpiresAt))
+
+	_, _, ok, err = repo.ConsumeEmailChange(ctx, "hash1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	userID, change, ok, err := repo.ConsumeEmailChange(ctx, "hash2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "1", userID)
+	assert.Equal(t, "new@example.com", change.Email)
+	assert.True(t, expiresAt.Equal(change.ExpiresAt))
+
+	// 確認すると確認待ちの変更はなくなる
+	_, ok, err = repo.GetEmailChange(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, _, ok, err = repo.ConsumeEmailChange(ctx, "hash2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestEmailChangeRepository_Delete(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	repo := repository.NewEmailChangeRepository(client)
+
+	err := repo.SaveEmailChange(ctx, "1", "hash1", &model.PendingEmailChange{
+		Email:     "new@example.com",
+		ExpiresAt: time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	// 取り消した変更の確認リンクは使えない
+	require.NoError(t, repo.DeleteEmailChange(ctx, "1"))
+	_, _, ok, err := repo.ConsumeEmailChange(ctx, "hash1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 確認待ちの変更がなくても成功する
+	assert.NoError(t, repo.DeleteEmailChange(ctx, "1"))
+
+	// 有効期限を過ぎた変更は取り出せない
+	err = repo.SaveEmailChange(ctx, "2", "hash2", &model.PendingEmailChange{
+		Email:     "new2@example.com",
+		ExpiresAt: time.Now().Add(time.Second),
+	})
+	require.NoError(t, err)
+	time.Sleep(2 * time.Second)
+	_, ok, err = repo.GetEmailChange(ctx, "2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, _, ok, err = repo.ConsumeEmailChange(ctx, "hash2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/generated/dbstore"
+)
+
+type identityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) *identityRepository {
+	return &identityRepository{db}
+}
+
+// 外部プロバイダーのIDに紐づくユーザーIDを取得する
+func (r *identityRepository) GetUserIDByIdentity(ctx context.Context, provider, subject string) (string, error) {
+	query := dbstore.New(r.db)
+	id, err := query.GetUserIDByIdentity(ctx, dbstore.GetUserIDByIdentityParams{
+		Provider: provider,
+		Subject:  subject,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", domain.ErrOIDCAccountNotFound.Wrap(err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// 外部プロバイダーのIDをユーザーに紐づける
+func (r *identityRepository) LinkIdentity(ctx context.Context, userID, provider, subject, email string) error {
+	publicID, err := parseUserID(userID)
+	if err != nil {
+		return err
+	}
+	query := dbstore.New(r.db)
+	n, err := query.CreateUserIdentity(ctx, dbstore.CreateUserIdentityParams{
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+		PublicID: publicID,
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/testing/container"
+	"github.com/yDog-1/wodun/backend/repository"
+)
+
+func TestIdentityRepository_LinkIdentity(t *testing.T) {
+	ctx := context.Background()
+
+	db, terminate := container.MysqlContainer(t, ctx, container.MySQLcontainerInput())
+	defer terminate()
+
+	users := repository.NewUserRepository(db)
+	repo := repository.NewIdentityRepository(db)
+
+	userID, err := users.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "ydog",
+		DisplayName: "yDog",
+		Email:       "ydog@example.com",
+	})
+	require.NoError(t, err)
+
+	// 紐づけ前は見つからない
+	_, err = repo.GetUserIDByIdentity(ctx, "google", "google-sub-123")
+	assert.ErrorIs(t, err, domain.ErrOIDCAccountNotFound)
+
+	err = repo.LinkIdentity(ctx, userID, "google", "google-sub-123", "ydog@example.com")
+	require.NoError(t, err)
+
+	id, err := repo.GetUserIDByIdentity(ctx, "google", "google-sub-123")
+	require.NoError(t, err)
+	assert.Equal(t, userID, id)
+
+	// 同じ外部アカウントを別のユーザーに紐づけることはできない
+	otherID, err := users.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "other",
+		DisplayName: "other",
+		Email:       "other@example.com",
+	})
+	require.NoError(t, err)
+	err = repo.LinkIdentity(ctx, otherID, "google", "google-sub-123", "other@example.com")
+	assert.Error(t, err)
+}
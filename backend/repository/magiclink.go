@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type magicLinkRepository struct {
+	store *redis.Client
+}
+
+func NewMagicLinkRepository(store *redis.Client) *magicLinkRepository {
+	return &magicLinkRepository{store}
+}
+
+// トークンのハッシュからRedisのキーを生成する
+func magicLinkKey(hash string) string {
+	return fmt.Sprintf("magiclink:%s", hash)
+}
+
+// マジックリンクを保存する
+// キーはトークンのハッシュ、値はリンクで認証する対象とし、ttlを過ぎると失効させる
+func (r *magicLinkRepository) SaveMagicLink(ctx context.Context, hash, value string, ttl time.Duration) error {
+	if err := r.store.Set(ctx, magicLinkKey(hash), value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save magic link to redis: %w", err)
+	}
+	return nil
+}
+
+// マジックリンクを取り出して削除する
+// GETDELで取得と削除を原子的に行うため、同じリンクは1回しか使えない
+func (r *magicLinkRepository) ConsumeMagicLink(ctx context.Context, hash string) (string, bool, error) {
+	value, err := r.store.GetDel(ctx, magicLinkKey(hash)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("failed to consume magic link from redis: %w", err)
+	}
+	return value, true, nil
+}
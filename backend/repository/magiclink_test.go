@@ -0,0 +1,45 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/pkg/testing/container"
+	"github.com/yDog-1/wodun/backend/repository"
+)
+
+func TestMagicLinkRepository_SaveAndConsume(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	repo := repository.NewMagicLinkRepository(client)
+
+	err := repo.SaveMagicLink(ctx, "hash1", "user123", time.Minute)
+	require.NoError(t, err)
+
+	// 1回目は取り出せる
+	value, ok, err := repo.ConsumeMagicLink(ctx, "hash1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "user123", value)
+
+	// 2回目は取り出せない
+	_, ok, err = repo.ConsumeMagicLink(ctx, "hash1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 有効期限を過ぎたリンクは取り出せない
+	err = repo.SaveMagicLink(ctx, "hash2", "user123", time.Second)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Second)
+	_, ok, err = repo.ConsumeMagicLink(ctx, "hash2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type oidcStateRepository struct {
+	store *redis.Client
+}
+
+func NewOIDCStateRepository(store *redis.Client) *oidcStateRepository {
+	return &oidcStateRepository{store}
+}
+
+// 認可リクエストごとに保持する値
+type oidcState struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// stateからRedisのキーを生成する
+func oidcStateKey(state string) string {
+	return fmt.Sprintf("oidc:state:%s", state)
+}
+
+// 認可リクエストの state に紐づけて nonce と PKCE のコードベリファイアを保存する
+func (r *oidcStateRepository) SaveOIDCState(ctx context.Context, state, nonce, verifier string, ttl time.Duration) error {
+	b, err := json.Marshal(oidcState{Nonce: nonce, Verifier: verifier})
+	if err != nil {
+		return err
+	}
+	if err := r.store.Set(ctx, oidcStateKey(state), b, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save oidc state to redis: %w", err)
+	}
+	return nil
+}
+
+// state に紐づく値を取り出して削除する
+// 同じ state でコールバックを2回処理できないよう、GETDELで取得と削除を原子的に行う
+func (r *oidcStateRepository) ConsumeOIDCState(ctx context.Context, state string) (nonce, verifier string, ok bool, err error) {
+	b, err := r.store.GetDel(ctx, oidcStateKey(state)).Bytes()
+	if err == redis.Nil {
+		return "", "", false, nil
+	} else if err != nil {
+		return "", "", false, fmt.Errorf("failed to consume oidc state from redis: %w", err)
+	}
+	var s oidcState
+	if err := json.Unmarshal(b, &s); err != nil {
+		return "", "", false, err
+	}
+	return s.Nonce, s.Verifier, true, nil
+}
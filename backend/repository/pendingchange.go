@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 確認リンクで確認するまで反映しない変更を、種類ごとのキーの接頭辞で分けて保持する
+// メールアドレスと電話番号の変更で共通に用いる
+type pendingChangeStore struct {
+	store *redis.Client
+	// キーの接頭辞。エラーメッセージにも用いる
+	prefix string
+}
+
+// ユーザーごとに保持する確認待ちの変更
+type pendingChange struct {
+	// 変更後の値
+	Value     string    `json:"value"`
+	TokenHash string    `json:"tokenHash"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ユーザーIDから確認待ちの変更のキーを生成する
+func (r *pendingChangeStore) userKey(userID string) string {
+	return fmt.Sprintf("%s:user:%s", r.prefix, userID)
+}
+
+// 確認リンクのトークンのハッシュからキーを生成する
+// 値は申請したユーザーのID
+func (r *pendingChangeStore) tokenKey(hash string) string {
+	return fmt.Sprintf("%s:token:%s", r.prefix, hash)
+}
+
+// 確認待ちの変更を保存し、expiresAt に失効させる
+// 既存の変更がある場合は、古い確認リンクのキーを同じトランザクションで削除する
+func (r *pendingChangeStore) save(ctx context.Context, userID, hash, value string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("%s is already expired", r.prefix)
+	}
+	old, ok, err := r.get(ctx, r.store, userID)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(pendingChange{Value: value, TokenHash: hash, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+	_, err = r.store.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if ok {
+			pipe.Del(ctx, r.tokenKey(old.TokenHash))
+		}
+		pipe.Set(ctx, r.userKey(userID), b, ttl)
+		pipe.Set(ctx, r.tokenKey(hash), userID, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save %s to redis: %w", r.prefix, err)
+	}
+	return nil
+}
+
+// 確認リンクのトークンのハッシュから確認待ちの変更を取り出して削除し、ユーザーIDと変更を返す
+// トークンのキーはGETDELで取り出すため、同じリンクは1回しか使えない
+func (r *pendingChangeStore) consume(ctx context.Context, hash string) (string, *pendingChange, bool, error) {
+	userID, err := r.store.GetDel(ctx, r.tokenKey(hash)).Result()
+	if err == redis.Nil {
+		return "", nil, false, nil
+	} else if err != nil {
+		return "", nil, false, fmt.Errorf("failed to consume %s from redis: %w", r.prefix, err)
+	}
+
+	var change *pendingChange
+	key := r.userKey(userID)
+	// 取り出す間に新しい申請で置き換えられた場合は、新しい申請を消さない
+	err = r.store.Watch(ctx, func(tx *redis.Tx) error {
+		c, ok, err := r.get(ctx, tx, userID)
+		if err != nil || !ok || c.TokenHash != hash {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		change = c
+		return nil
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		return "", nil, false, nil
+	} else if err != nil {
+		return "", nil, false, fmt.Errorf("failed to consume %s from redis: %w", r.prefix, err)
+	}
+	if change == nil {
+		return "", nil, false, nil
+	}
+	return userID, change, true, nil
+}
+
+func (r *pendingChangeStore) delete(ctx context.Context, userID string) error {
+	c, ok, err := r.get(ctx, r.store, userID)
+	if err != nil || !ok {
+		return err
+	}
+	err = r.store.Del(ctx, r.userKey(userID), r.tokenKey(c.TokenHash)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from redis: %w", r.prefix, err)
+	}
+	return nil
+}
+
+func (r *pendingChangeStore) get(ctx context.Context, c redis.Cmdable, userID string) (*pendingChange, bool, error) {
+	b, err := c.Get(ctx, r.userKey(userID)).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to get %s from redis: %w", r.prefix, err)
+	}
+	var change pendingChange
+	if err := json.Unmarshal(b, &change); err != nil {
+		return nil, false, err
+	}
+	return &change, true, nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yDog-1/wodun/backend/graph/model"
+)
+
+type phoneChangeRepository struct {
+	changes pendingChangeStore
+}
+
+func NewPhoneChangeRepository(store *redis.Client) *phoneChangeRepository {
+	return &phoneChangeRepository{pendingChangeStore{store: store, prefix: "phonechange"}}
+}
+
+// 確認待ちの変更を保存し、change.ExpiresAt に失効させる
+func (r *phoneChangeRepository) SavePhoneChange(ctx context.Context, userID, hash string, change *model.PendingPhoneChange) error {
+	return r.changes.save(ctx, userID, hash, change.Phone, change.ExpiresAt)
+}
+
+func (r *phoneChangeRepository) GetPhoneChange(ctx context.Context, userID string) (*model.PendingPhoneChange, bool, error) {
+	c, ok, err := r.changes.get(ctx, r.changes.store, userID)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return &model.PendingPhoneChange{Phone: c.Value, ExpiresAt: c.ExpiresAt}, true, nil
+}
+
+// 確認リンクのトークンのハッシュから確認待ちの変更を取り出して削除する
+func (r *phoneChangeRepository) ConsumePhoneChange(ctx context.Context, hash string) (string, *model.PendingPhoneChange, bool, error) {
+	userID, c, ok, err := r.changes.consume(ctx, hash)
+	if err != nil || !ok {
+		return "", nil, false, err
+	}
+	return userID, &model.PendingPhoneChange{Phone: c.Value, ExpiresAt: c.ExpiresAt}, true, nil
+}
+
+func (r *phoneChangeRepository) DeletePhoneChange(ctx context.Context, userID string) error {
+	return r.changes.delete(ctx, userID)
+}
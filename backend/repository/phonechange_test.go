@@ -0,0 +1,57 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/testing/container"
+	"github.com/yDog-1/wodun/backend/repository"
+)
+
+func TestPhoneChangeRepository(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	phones := repository.NewPhoneChangeRepository(client)
+	emails := repository.NewEmailChangeRepository(client)
+	expiresAt := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	err := phones.SavePhoneChange(ctx, "1", "hash", &model.PendingPhoneChange{Phone: "+819012345678", ExpiresAt: expiresAt})
+	require.NoError(t, err)
+	// 同じユーザーのメールアドレスの変更とは別に保持する
+	err = emails.SaveEmailChange(ctx, "1", "hash", &model.PendingEmailChange{Email: "new@example.com", ExpiresAt: expiresAt})
+	require.NoError(t, err)
+
+	change, ok, err := phones.GetPhoneChange(ctx, "1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "+819012345678", change.Phone)
+	assert.True(t, expiresAt.Equal(change.ExpiresAt))
+
+	userID, consumed, ok, err := phones.ConsumePhoneChange(ctx, "hash")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "1", userID)
+	assert.Equal(t, "+819012345678", consumed.Phone)
+	assert.True(t, expiresAt.Equal(consumed.ExpiresAt))
+
+	_, ok, err = emails.GetEmailChange(ctx, "1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	err = emails.SaveEmailChange(ctx, "2", "hash2", &model.PendingEmailChange{Email: "other@example.com", ExpiresAt: expiresAt})
+	require.NoError(t, err)
+	err = phones.DeletePhoneChange(ctx, "2")
+	require.NoError(t, err)
+	_, ok, err = emails.GetEmailChange(ctx, "2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
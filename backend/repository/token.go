@@ -3,60 +3,249 @@ package repository
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/redis/go-redis/v9"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
 )
 
 type tokenRepository struct {
 	store *redis.Client
 }
 
-type storeClaims interface {
-	jwt.Claims
-	GetJTI() (string, error)
-}
-
 func NewTokenRepository(store *redis.Client) *tokenRepository {
 	return &tokenRepository{store}
 }
 
+// ユーザーIDとJTIからRedisのキーを生成する
+// ユーザーごと、トークンごとにキーを分けることで、複数のセッションを同時に保持できる
+func jtiKey(id, jti string) string {
+	return fmt.Sprintf("jti:%s:%s", id, jti)
+}
+
+// リフレッシュトークンのファミリーに属するJTIの集合を保持するキーを生成する
+func familyKey(id, family string) string {
+	return fmt.Sprintf("family:%s:%s", id, family)
+}
+
 // JTIを保存する
-// RedisのキーはユーザーID、値はJTIとする
-func (r *tokenRepository) SaveJTI(ctx context.Context, claims storeClaims) error {
-	id, err := claims.GetSubject()
+// キーはユーザーIDとJTIの組とし、トークン自身の有効期限で失効させる
+func (r *tokenRepository) SaveJTI(ctx context.Context, id, jti string, exp time.Time) error {
+	if id == "" || jti == "" {
+		return fmt.Errorf("id and jti must not be empty")
+	}
+	err := r.store.SetArgs(ctx, jtiKey(id, jti), 1, redis.SetArgs{ExpireAt: exp}).Err()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to save JTI to redis: %w", err)
 	}
-	jti, err := claims.GetJTI()
+	return nil
+}
+
+// JTIが存在するか確認する
+// ユーザーIDとJTIの組に対応するキーが残っていれば有効とみなす
+func (r *tokenRepository) ExistsJTI(ctx context.Context, id, jti string) (bool, error) {
+	n, err := r.store.Exists(ctx, jtiKey(id, jti)).Result()
 	if err != nil {
-		return err
+		return false, fmt.Errorf("failed to get JTI from redis: %w", err)
 	}
-	exptime, err := claims.GetExpirationTime()
+	return n > 0, nil
+}
+
+// JTIを削除する
+// DELは原子的に実行されるため、同じJTIを同時に削除しようとしても成功するのは一方だけになる
+func (r *tokenRepository) DeleteJTI(ctx context.Context, id, jti string) (bool, error) {
+	n, err := r.store.Del(ctx, jtiKey(id, jti)).Result()
 	if err != nil {
-		return err
+		return false, fmt.Errorf("failed to delete JTI from redis: %w", err)
 	}
-	// 有効期限をtime.Durationに変換
-	exp := time.Until(exptime.Time)
+	return n > 0, nil
+}
 
-	// RedisにユーザーIDをキー、JTIを値として保存。有効期限も設定する。
-	return r.store.Set(ctx, id, jti, exp).Err()
+// JTIをリフレッシュトークンのファミリーに加える
+// ファミリーの有効期限は最後に発行されたリフレッシュトークンの有効期限に合わせる
+func (r *tokenRepository) AddFamilyJTI(ctx context.Context, id, family string, exp time.Time, jtis ...string) error {
+	if family == "" {
+		return fmt.Errorf("family must not be empty")
+	}
+	key := familyKey(id, family)
+	members := make([]any, len(jtis))
+	for i, jti := range jtis {
+		members[i] = jti
+	}
+	_, err := r.store.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, members...)
+		pipe.ExpireAt(ctx, key, exp)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add JTI to family: %w", err)
+	}
+	return nil
 }
 
-// JTIが存在するか確認する
-// RedisにユーザーIDをキーとして保存されているJTIと、引数で渡されたJTIが一致するかを確認する
-func (r *tokenRepository) ExistsJTI(ctx context.Context, id, jti string) (bool, error) {
-	// RedisからユーザーIDに対応するJTIを取得
-	storedJTI, err := r.store.Get(ctx, id).Result()
-	if err == redis.Nil {
-		// キーが存在しない場合はJTIも存在しない
-		return false, nil
-	} else if err != nil {
-		// その他のエラー
-		return false, fmt.Errorf("failed to get JTI from redis: %w", err)
+// ファミリーに属する全てのJTIとファミリー自体、およびセッションを削除する
+// 削除したJTIを返す。ファミリーが存在しない場合は空になる
+func (r *tokenRepository) RevokeFamily(ctx context.Context, id, family string) ([]string, error) {
+	key := familyKey(id, family)
+	jtis, err := r.store.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get family members from redis: %w", err)
+	}
+	keys := make([]string, 0, len(jtis)+2)
+	for _, jti := range jtis {
+		keys = append(keys, jtiKey(id, jti))
 	}
+	keys = append(keys, key, sessionKey(id, family))
+	_, err = r.store.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		pipe.SRem(ctx, sessionsKey(id), family)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke family: %w", err)
+	}
+	return jtis, nil
+}
+
+// 拒否リストに加えたJTIのキーを生成する
+func denyKey(jti string) string {
+	return fmt.Sprintf("denylist:%s", jti)
+}
 
-	// 取得したJTIと引数のJTIが一致するか確認
-	return storedJTI == jti, nil
+// JTIを拒否リストに加える
+func (r *tokenRepository) DenyJTI(ctx context.Context, exp time.Time, jtis ...string) error {
+	_, err := r.store.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, jti := range jtis {
+			pipe.SetArgs(ctx, denyKey(jti), 1, redis.SetArgs{ExpireAt: exp})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add JTI to denylist: %w", err)
+	}
+	return nil
+}
+
+// JTIが拒否リストに含まれているか確認する
+func (r *tokenRepository) IsDeniedJTI(ctx context.Context, jti string) (bool, error) {
+	n, err := r.store.Exists(ctx, denyKey(jti)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to get JTI from denylist: %w", err)
+	}
+	return n > 0, nil
+}
+
+// セッションの情報を保持するハッシュのキーを生成する
+func sessionKey(id, family string) string {
+	return fmt.Sprintf("session:%s:%s", id, family)
+}
+
+// ユーザーのセッションIDの集合を保持するキーを生成する
+func sessionsKey(id string) string {
+	return fmt.Sprintf("sessions:%s", id)
+}
+
+const (
+	sessionUserAgent  = "user_agent"
+	sessionCreatedAt  = "created_at"
+	sessionLastUsedAt = "last_used_at"
+	sessionExpiresAt  = "expires_at"
+)
+
+// セッションを保存する
+// 新しいセッションほど有効期限が遅いため、ユーザーの集合の有効期限は最後に保存したセッションに合わせる
+func (r *tokenRepository) SaveSession(ctx context.Context, id string, s auth.Session) error {
+	if s.ID == "" {
+		return fmt.Errorf("session id must not be empty")
+	}
+	key := sessionKey(id, s.ID)
+	_, err := r.store.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			sessionUserAgent, s.UserAgent,
+			sessionCreatedAt, s.CreatedAt.Unix(),
+			sessionLastUsedAt, s.LastUsedAt.Unix(),
+			sessionExpiresAt, s.ExpiresAt.Unix(),
+		)
+		pipe.ExpireAt(ctx, key, s.ExpiresAt)
+		pipe.SAdd(ctx, sessionsKey(id), s.ID)
+		pipe.ExpireAt(ctx, sessionsKey(id), s.ExpiresAt)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save session to redis: %w", err)
+	}
+	return nil
+}
+
+// セッションの最終利用時刻と有効期限を更新する
+// セッションの記録がない場合は、作成時刻を不明として最終利用時刻で作り直す
+func (r *tokenRepository) TouchSession(ctx context.Context, id, family string, usedAt, exp time.Time) error {
+	key := sessionKey(id, family)
+	_, err := r.store.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(ctx, key, sessionCreatedAt, usedAt.Unix())
+		pipe.HSet(ctx, key,
+			sessionLastUsedAt, usedAt.Unix(),
+			sessionExpiresAt, exp.Unix(),
+		)
+		pipe.ExpireAt(ctx, key, exp)
+		pipe.SAdd(ctx, sessionsKey(id), family)
+		pipe.ExpireAt(ctx, sessionsKey(id), exp)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+	return nil
+}
+
+// ユーザーの有効なセッションを返す
+// 有効期限で消えたセッションは集合からも取り除く
+func (r *tokenRepository) ListSessions(ctx context.Context, id string) ([]auth.Session, error) {
+	families, err := r.store.SMembers(ctx, sessionsKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions from redis: %w", err)
+	}
+	cmds := make([]*redis.MapStringStringCmd, len(families))
+	_, err = r.store.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, family := range families {
+			cmds[i] = pipe.HGetAll(ctx, sessionKey(id, family))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions from redis: %w", err)
+	}
+
+	sessions := make([]auth.Session, 0, len(families))
+	var expired []any
+	for i, cmd := range cmds {
+		v := cmd.Val()
+		if len(v) == 0 {
+			expired = append(expired, families[i])
+			continue
+		}
+		sessions = append(sessions, auth.Session{
+			ID:         families[i],
+			UserAgent:  v[sessionUserAgent],
+			CreatedAt:  unixField(v, sessionCreatedAt),
+			LastUsedAt: unixField(v, sessionLastUsedAt),
+			ExpiresAt:  unixField(v, sessionExpiresAt),
+		})
+	}
+	if len(expired) > 0 {
+		if err := r.store.SRem(ctx, sessionsKey(id), expired...).Err(); err != nil {
+			return nil, fmt.Errorf("failed to remove expired sessions: %w", err)
+		}
+	}
+	return sessions, nil
+}
+
+// ハッシュに保存した UNIX 時刻を読み取る
+func unixField(v map[string]string, field string) time.Time {
+	sec, err := strconv.ParseInt(v[field], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
 }
@@ -5,21 +5,16 @@ import (
 	"testing"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
 	"github.com/yDog-1/wodun/backend/pkg/testing/container"
 	"github.com/yDog-1/wodun/backend/repository"
 )
 
-type storeClaims struct {
-	jwt.RegisteredClaims
-	Jti string `json:"jti"`
-}
-
-func (c storeClaims) GetJTI() (string, error) {
-	return c.Jti, nil
-}
+// tokenRepository が auth.TokenStore を満たすことを保証する
+var _ auth.TokenStore = repository.NewTokenRepository(nil)
 
 func TestTokenRepository_SaveJTIAndExistsJTI(t *testing.T) {
 	ctx := context.Background()
@@ -38,17 +33,8 @@ func TestTokenRepository_SaveJTIAndExistsJTI(t *testing.T) {
 	jti := uuid.New().String()
 	expirationTime := time.Now().Add(time.Minute) // 1分後に期限切れ
 
-	// storeClaimsを作成
-	claims := storeClaims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   userID,
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
-		Jti: jti,
-	}
-
 	// SaveJTIのテスト
-	err := repo.SaveJTI(ctx, claims)
+	err := repo.SaveJTI(ctx, userID, jti, expirationTime)
 	assert.NoError(t, err, "SaveJTI should not return an error")
 
 	// ExistsJTIのテスト (存在するJTI)
@@ -70,14 +56,7 @@ func TestTokenRepository_SaveJTIAndExistsJTI(t *testing.T) {
 
 	// JTIが期限切れになった後のテスト (短い期限で保存し直す)
 	shortExpirationTime := time.Now().Add(time.Second) // 1秒後に期限切れ
-	shortClaims := storeClaims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   userID,
-			ExpiresAt: jwt.NewNumericDate(shortExpirationTime),
-		},
-		Jti: jti,
-	}
-	err = repo.SaveJTI(ctx, shortClaims)
+	err = repo.SaveJTI(ctx, userID, jti, shortExpirationTime)
 	assert.NoError(t, err, "SaveJTI should not return an error when saving with short expiration")
 
 	time.Sleep(2 * time.Second) // 期限切れまで待つ
@@ -86,3 +65,165 @@ func TestTokenRepository_SaveJTIAndExistsJTI(t *testing.T) {
 	assert.NoError(t, err, "ExistsJTI should not return an error after expiration")
 	assert.False(t, exists, "ExistsJTI should return false after expiration")
 }
+
+func TestTokenRepository_複数のセッションを保持する(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	repo := repository.NewTokenRepository(client)
+
+	userID := "user123"
+	phoneJTI := uuid.New().String()
+	laptopJTI := uuid.New().String()
+
+	// スマートフォンとノートPCで順にログインする
+	err := repo.SaveJTI(ctx, userID, phoneJTI, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	err = repo.SaveJTI(ctx, userID, laptopJTI, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	// 後からのログインで先のセッションが上書きされないこと
+	exists, err := repo.ExistsJTI(ctx, userID, phoneJTI)
+	require.NoError(t, err)
+	assert.True(t, exists, "first session should still exist")
+
+	exists, err = repo.ExistsJTI(ctx, userID, laptopJTI)
+	require.NoError(t, err)
+	assert.True(t, exists, "second session should exist")
+
+	// キーごとにトークン自身の有効期限が設定されていること
+	ttl, err := client.TTL(ctx, "jti:"+userID+":"+phoneJTI).Result()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, ttl, time.Minute)
+	ttl, err = client.TTL(ctx, "jti:"+userID+":"+laptopJTI).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Minute)
+}
+
+func TestTokenRepository_RevokeFamily(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	repo := repository.NewTokenRepository(client)
+
+	userID := "user123"
+	family := uuid.New().String()
+	exp := time.Now().Add(time.Minute)
+	jtis := []string{uuid.New().String(), uuid.New().String()}
+	for _, jti := range jtis {
+		require.NoError(t, repo.SaveJTI(ctx, userID, jti, exp))
+	}
+	require.NoError(t, repo.AddFamilyJTI(ctx, userID, family, exp, jtis...))
+
+	// 削除できるのは1回だけ
+	deleted, err := repo.DeleteJTI(ctx, userID, jtis[0])
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = repo.DeleteJTI(ctx, userID, jtis[0])
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	// ファミリーを失効させると残りのJTIも削除され、失効させたJTIが返る
+	revoked, err := repo.RevokeFamily(ctx, userID, family)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, jtis, revoked)
+	exists, err := repo.ExistsJTI(ctx, userID, jtis[1])
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// 失効済みのファミリーからは何も返らない
+	revoked, err = repo.RevokeFamily(ctx, userID, family)
+	require.NoError(t, err)
+	assert.Empty(t, revoked)
+}
+
+func TestTokenRepository_Sessions(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	repo := repository.NewTokenRepository(client)
+
+	userID := "user123"
+	now := time.Now().UTC().Truncate(time.Second)
+	phone := auth.Session{
+		ID:         uuid.New().String(),
+		UserAgent:  "Safari on iOS",
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(time.Hour),
+	}
+	laptop := auth.Session{
+		ID:         uuid.New().String(),
+		UserAgent:  "Firefox on Linux",
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(2 * time.Second),
+	}
+	require.NoError(t, repo.SaveSession(ctx, userID, phone))
+	require.NoError(t, repo.SaveSession(ctx, userID, laptop))
+
+	sessions, err := repo.ListSessions(ctx, userID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []auth.Session{phone, laptop}, sessions)
+
+	// リフレッシュで最終利用時刻と有効期限が更新される
+	usedAt := now.Add(time.Minute)
+	require.NoError(t, repo.TouchSession(ctx, userID, phone.ID, usedAt, now.Add(2*time.Hour)))
+
+	// 有効期限を過ぎたセッションは一覧から消える
+	time.Sleep(3 * time.Second)
+	sessions, err = repo.ListSessions(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, phone.ID, sessions[0].ID)
+	assert.Equal(t, phone.CreatedAt, sessions[0].CreatedAt)
+	assert.Equal(t, usedAt, sessions[0].LastUsedAt)
+	assert.Equal(t, now.Add(2*time.Hour), sessions[0].ExpiresAt)
+
+	// ファミリーを失効させるとセッションも消える
+	require.NoError(t, repo.AddFamilyJTI(ctx, userID, phone.ID, phone.ExpiresAt, uuid.New().String()))
+	_, err = repo.RevokeFamily(ctx, userID, phone.ID)
+	require.NoError(t, err)
+	sessions, err = repo.ListSessions(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestTokenRepository_DenyJTI(t *testing.T) {
+	ctx := context.Background()
+
+	client, terminate := container.NewRedisContainer(t, ctx, container.RedisContainerInput(
+		container.WithRedisImage("redis:8-alpine"),
+	))
+	defer terminate()
+
+	repo := repository.NewTokenRepository(client)
+
+	denied := uuid.New().String()
+	require.NoError(t, repo.DenyJTI(ctx, time.Now().Add(time.Second), denied))
+
+	ok, err := repo.IsDeniedJTI(ctx, denied)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = repo.IsDeniedJTI(ctx, uuid.New().String())
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 有効期限を過ぎると拒否リストから外れる
+	time.Sleep(2 * time.Second)
+	ok, err = repo.IsDeniedJTI(ctx, denied)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -3,13 +3,30 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"strconv"
+	"strings"
 
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/yDog-1/wodun/backend/domain"
 	"github.com/yDog-1/wodun/backend/generated/dbstore"
 	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/confusable"
 )
 
+// 一意制約違反を表す MySQL のエラー番号 (ER_DUP_ENTRY)
+const mysqlErrDuplicateEntry = 1062
+
+// users の一意制約のインデックス名と、衝突した場合に返すエラー
+var userUniqueKeys = map[string]error{
+	"users_unique_name_key":          domain.ErrUniqueNameTaken,
+	"users_unique_name_skeleton_key": domain.ErrUniqueNameConfusable,
+	"users_email_key":                domain.ErrEmailTaken,
+	"users_phone_key":                domain.ErrPhoneTaken,
+}
+
 type userRepository struct {
 	db *sql.DB
 }
@@ -18,80 +35,332 @@ func NewUserRepository(db *sql.DB) *userRepository {
 	return &userRepository{db}
 }
 
+// DBのユーザーをGraphQLのモデルに変換する
+func toUser(user dbstore.User) *model.User {
+	u := &model.User{
+		ID:            user.PublicID,
+		UniqueName:    user.UniqueName,
+		DisplayName:   user.DisplayName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          auth.Role(user.Role),
+	}
+	u.Phone = stringPtr(user.Phone)
+	return u
+}
+
+// 省略可能な文字列をNULL許容の文字列に変換する
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+// NULL許容の文字列を省略可能な文字列に変換する
+func stringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// ユーザーIDを検証し、DBに保存している形式にそろえる
+func parseUserID(id string) (string, error) {
+	return domain.CanonicalUserID(id)
+}
+
+// DBのエラーをクライアントに種類を伝えるエラーに変換する
+// 一意制約違反のメッセージには衝突した値が含まれるため、元のエラーは返さない
+func translateUserError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrUserNotFound.Wrap(err)
+	}
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) || me.Number != mysqlErrDuplicateEntry {
+		return err
+	}
+	// メッセージは "Duplicate entry '...' for key 'users.users_email_key'" の形式
+	i := strings.LastIndex(me.Message, " for key '")
+	if i < 0 {
+		return err
+	}
+	key := strings.TrimSuffix(me.Message[i+len(" for key '"):], "'")
+	key = key[strings.LastIndex(key, ".")+1:]
+	if e, ok := userUniqueKeys[key]; ok {
+		return e
+	}
+	return err
+}
+
 func (r *userRepository) GetUser(ctx context.Context, uniqueName string) (*model.User, error) {
 	query := dbstore.New(r.db)
 	user, err := query.GetUser(ctx, uniqueName)
+	if err != nil {
+		return nil, translateUserError(err)
+	}
+	return toUser(user), nil
+}
+
+func (r *userRepository) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	query := dbstore.New(r.db)
+	publicID, err := parseUserID(id)
 	if err != nil {
 		return nil, err
 	}
-	return &model.User{
-		ID:          fmt.Sprint(user.ID),
-		UniqueName:  user.UniqueName,
-		DisplayName: user.DisplayName,
-		Email:       user.Email,
-	}, nil
+	user, err := query.GetUserByPublicID(ctx, publicID)
+	if err != nil {
+		return nil, translateUserError(err)
+	}
+	return toUser(user), nil
 }
 
+// IDの一覧に含まれるユーザーを1回のクエリで取得する
+// 存在しないIDや、IDとして解釈できない値は結果に含めない。結果の順序は ids と一致しない
+func (r *userRepository) GetUsersByIDs(ctx context.Context, ids []string) ([]*model.User, error) {
+	publicIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if publicID, err := parseUserID(id); err == nil {
+			publicIDs = append(publicIDs, publicID)
+		}
+	}
+	if len(publicIDs) == 0 {
+		return nil, nil
+	}
+	query := dbstore.New(r.db)
+	users, err := query.GetUsersByPublicIDs(ctx, publicIDs)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*model.User, len(users))
+	for i, u := range users {
+		res[i] = toUser(u)
+	}
+	return res, nil
+}
+
+func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	query := dbstore.New(r.db)
+	user, err := query.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, translateUserError(err)
+	}
+	return toUser(user), nil
+}
+
+// 固有名と見た目の紛らわしい固有名のユーザーを取得する
+func (r *userRepository) GetUserByConfusableName(ctx context.Context, uniqueName string) (*model.User, error) {
+	query := dbstore.New(r.db)
+	user, err := query.GetUserByUniqueNameSkeleton(ctx, confusable.Skeleton(uniqueName))
+	if err != nil {
+		return nil, translateUserError(err)
+	}
+	return toUser(user), nil
+}
+
+func (r *userRepository) GetUserByPhone(ctx context.Context, phone string) (*model.User, error) {
+	query := dbstore.New(r.db)
+	user, err := query.GetUserByPhone(ctx, sql.NullString{String: phone, Valid: true})
+	if err != nil {
+		return nil, translateUserError(err)
+	}
+	return toUser(user), nil
+}
+
+// ユーザーを公開用のIDの順、つまり作成順に、after より後ろから limit 件まで取得する
+func (r *userRepository) ListUsers(ctx context.Context, after string, limit int) ([]*model.User, error) {
+	query := dbstore.New(r.db)
+	users, err := query.ListUsers(ctx, dbstore.ListUsersParams{
+		After: after,
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*model.User, len(users))
+	for i, u := range users {
+		res[i] = toUser(u)
+	}
+	return res, nil
+}
+
+// ユーザーを作成し、公開用のユーザーIDを返す
 func (r *userRepository) CreateUser(ctx context.Context, input *model.CreateUserInput) (string, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
+	query := dbstore.New(r.db)
+	publicID, err := uuid.NewV7()
 	if err != nil {
 		return "", err
 	}
+
+	err = query.CreateUser(ctx, dbstore.CreateUserParams{
+		PublicID:           publicID.String(),
+		UniqueName:         input.UniqueName,
+		UniqueNameSkeleton: confusable.Skeleton(input.UniqueName),
+		DisplayName:        input.DisplayName,
+		Email:              input.Email,
+	})
+	if err != nil {
+		return "", translateUserError(err)
+	}
+	return publicID.String(), nil
+}
+
+func (r *userRepository) UpdateUser(ctx context.Context, id string, input *model.UpdateUserInput) error {
+	query := dbstore.New(r.db)
+
+	publicID, err := parseUserID(id)
+	if err != nil {
+		return err
+	}
+
+	err = query.UpdateUser(ctx, dbstore.UpdateUserParams{
+		DisplayName: nullString(input.DisplayName),
+		PublicID:    publicID,
+	})
+
+	if err != nil {
+		return translateUserError(err)
+	}
+	return nil
+}
+
+// ユーザーの固有名を変更し、同じトランザクションで監査ログに記録する
+func (r *userRepository) RenameUser(ctx context.Context, actorID, id, uniqueName, reason string) error {
+	publicID, err := parseUserID(id)
+	if err != nil {
+		return err
+	}
+	actorPublicID, err := parseUserID(actorID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
 	defer tx.Rollback()
 	query := dbstore.New(tx)
 
-	err = query.CreateUser(ctx, dbstore.CreateUserParams{
-		UniqueName:  input.UniqueName,
-		DisplayName: input.DisplayName,
-		Email:       input.Email,
+	user, err := query.GetUserByPublicID(ctx, publicID)
+	if err != nil {
+		return translateUserError(err)
+	}
+	actor, err := query.GetUserByPublicID(ctx, actorPublicID)
+	if err != nil {
+		return translateUserError(err)
+	}
+	err = query.RenameUser(ctx, dbstore.RenameUserParams{
+		UniqueName:         uniqueName,
+		UniqueNameSkeleton: confusable.Skeleton(uniqueName),
+		ID:                 user.ID,
 	})
 	if err != nil {
-		return "", err
+		return translateUserError(err)
 	}
+	err = query.CreateUserAuditLog(ctx, dbstore.CreateUserAuditLogParams{
+		ActorID:  actor.ID,
+		UserID:   user.ID,
+		Action:   string(model.UserAuditActionRename),
+		OldValue: user.UniqueName,
+		NewValue: uniqueName,
+		Reason:   reason,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-	id, err := query.LastInsertId(ctx)
+// ユーザーに対する管理者の操作の記録を、新しい順に取得する
+// 操作した管理者が削除されている場合、ActorID は nil になる
+func (r *userRepository) ListUserAuditLogs(ctx context.Context, id string) ([]*model.UserAuditLog, error) {
+	query := dbstore.New(r.db)
+	publicID, err := parseUserID(id)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	err = tx.Commit()
+	logs, err := query.ListUserAuditLogs(ctx, publicID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	res := make([]*model.UserAuditLog, len(logs))
+	for i, l := range logs {
+		res[i] = &model.UserAuditLog{
+			ID:        fmt.Sprint(l.ID),
+			ActorID:   stringPtr(l.ActorID),
+			UserID:    l.UserID,
+			Action:    model.UserAuditAction(l.Action),
+			OldValue:  l.OldValue,
+			NewValue:  l.NewValue,
+			Reason:    l.Reason,
+			CreatedAt: l.CreatedAt,
+		}
 	}
-	return fmt.Sprint(id), nil
+	return res, nil
 }
 
-func (r *userRepository) UpdateUser(ctx context.Context, id string, input *model.UpdateUserInput) error {
+// メールアドレスを変更する
+// 変更は新しいアドレスに送った確認リンクで行うため、確認済みにする
+func (r *userRepository) UpdateUserEmail(ctx context.Context, id string, email string) error {
 	query := dbstore.New(r.db)
 
-	var un, dn, em sql.NullString
-	if input.UniqueName != nil {
-		un.String = *input.UniqueName
-		un.Valid = true
-	}
-	if input.DisplayName != nil {
-		dn.String = *input.DisplayName
-		dn.Valid = true
+	publicID, err := parseUserID(id)
+	if err != nil {
+		return err
 	}
-	if input.Email != nil {
-		em.String = *input.Email
-		em.Valid = true
+
+	err = query.UpdateUserEmail(ctx, dbstore.UpdateUserEmailParams{
+		Email:    email,
+		PublicID: publicID,
+	})
+	return translateUserError(err)
+}
+
+// メールアドレスを確認済みにする
+// 確認の間にメールアドレスが変更されていた場合は何もしない
+func (r *userRepository) VerifyUserEmail(ctx context.Context, id string, email string) error {
+	query := dbstore.New(r.db)
+
+	publicID, err := parseUserID(id)
+	if err != nil {
+		return err
 	}
-	uintID, err := strconv.ParseUint(id, 10, 64)
+
+	return query.VerifyUserEmail(ctx, dbstore.VerifyUserEmailParams{
+		PublicID: publicID,
+		Email:    email,
+	})
+}
+
+// ユーザーの電話番号を変更する。phone が nil の場合は削除する
+func (r *userRepository) UpdateUserPhone(ctx context.Context, id string, phone *string) error {
+	query := dbstore.New(r.db)
+
+	publicID, err := parseUserID(id)
 	if err != nil {
 		return err
 	}
 
-	err = query.UpdateUser(ctx, dbstore.UpdateUserParams{
-		UniqueName:  un,
-		DisplayName: dn,
-		Email:       em,
-		ID:          uintID,
+	err = query.UpdateUserPhone(ctx, dbstore.UpdateUserPhoneParams{
+		Phone:    nullString(phone),
+		PublicID: publicID,
 	})
+	return translateUserError(err)
+}
+
+func (r *userRepository) UpdateUserRole(ctx context.Context, id string, role auth.Role) error {
+	query := dbstore.New(r.db)
 
+	publicID, err := parseUserID(id)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return query.UpdateUserRole(ctx, dbstore.UpdateUserRoleParams{
+		Role:     string(role),
+		PublicID: publicID,
+	})
 }
 
 func (r *userRepository) DeleteUser(ctx context.Context, uniqueName string) error {
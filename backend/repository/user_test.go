@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/generated/dbstore"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/pagination"
+	"github.com/yDog-1/wodun/backend/pkg/testing/container"
+)
+
+func TestTranslateUserError(t *testing.T) {
+	other := errors.New("other")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "固有名の重複",
+			err:  &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'ydog' for key 'users.users_unique_name_key'"},
+			want: domain.ErrUniqueNameTaken,
+		},
+		{
+			name: "見た目の紛らわしい固有名",
+			err:  &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'yclog' for key 'users.users_unique_name_skeleton_key'"},
+			want: domain.ErrUniqueNameConfusable,
+		},
+		{
+			name: "メールアドレスの重複",
+			err:  &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'ydog@example.com' for key 'users.users_email_key'"},
+			want: domain.ErrEmailTaken,
+		},
+		{
+			name: "テーブル名を含まない形式",
+			err:  &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '+819012345678' for key 'users_phone_key'"},
+			want: domain.ErrPhoneTaken,
+		},
+		{
+			name: "ラップされたエラー",
+			err:  errors.Join(other, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'x' for key 'users.users_email_key'"}),
+			want: domain.ErrEmailTaken,
+		},
+		{
+			name: "ユーザーが存在しない",
+			err:  sql.ErrNoRows,
+			want: domain.ErrUserNotFound,
+		},
+		{
+			name: "他のインデックスの重複はそのまま返す",
+			err:  &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'users.PRIMARY'"},
+		},
+		{
+			name: "一意制約違反以外はそのまま返す",
+			err:  &mysql.MySQLError{Number: 1406, Message: "Data too long for column 'unique_name' at row 1"},
+		},
+		{
+			name: "MySQL 以外のエラー",
+			err:  other,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateUserError(tt.err)
+			if tt.want == nil {
+				assert.Equal(t, tt.err, got)
+				return
+			}
+			assert.ErrorIs(t, got, tt.want)
+		})
+	}
+	assert.NoError(t, translateUserError(nil))
+}
+
+func TestParseUserID(t *testing.T) {
+	id, err := parseUserID("0192F5B0-6C1E-7A3B-8C4D-5E6F7A8B9C0D")
+	require.NoError(t, err)
+	// 大文字で指定しても、保存している小文字の形式にそろえる
+	assert.Equal(t, "0192f5b0-6c1e-7a3b-8c4d-5e6f7a8b9c0d", id)
+
+	// 連番のIDや UUID でない文字列のユーザーは存在しない
+	for _, id := range []string{"1", "", "not-a-uuid"} {
+		_, err := parseUserID(id)
+		assert.ErrorIs(t, err, domain.ErrUserNotFound, id)
+	}
+}
+
+func TestUserRepository_VerifyUserEmail(t *testing.T) {
+	ctx := context.Background()
+
+	db, terminate := container.MysqlContainer(t, ctx, container.MySQLcontainerInput())
+	defer terminate()
+	repo := NewUserRepository(db)
+
+	id, err := repo.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "ydog",
+		DisplayName: "yDog",
+		Email:       "ydog@example.com",
+	})
+	require.NoError(t, err)
+
+	// 登録しただけではメールアドレスの所有を確認していない
+	user, err := repo.GetUserByID(ctx, id)
+	require.NoError(t, err)
+	assert.False(t, user.EmailVerified)
+
+	// 確認の間に変更された古いアドレスでは確認済みにしない
+	require.NoError(t, repo.VerifyUserEmail(ctx, id, "old@example.com"))
+	user, err = repo.GetUserByID(ctx, id)
+	require.NoError(t, err)
+	assert.False(t, user.EmailVerified)
+
+	require.NoError(t, repo.VerifyUserEmail(ctx, id, "ydog@example.com"))
+	user, err = repo.GetUserByEmail(ctx, "ydog@example.com")
+	require.NoError(t, err)
+	assert.True(t, user.EmailVerified)
+
+	// 確認リンクで変更したアドレスは確認済みになる
+	require.NoError(t, repo.UpdateUserEmail(ctx, id, "new@example.com"))
+	user, err = repo.GetUserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.True(t, user.EmailVerified)
+}
+
+func TestUserRepository_ListUsers(t *testing.T) {
+	ctx := context.Background()
+
+	db, terminate := container.MysqlContainer(t, ctx, container.MySQLcontainerInput())
+	defer terminate()
+	repo := NewUserRepository(db)
+
+	var ids []string
+	for _, name := range []string{"user_a", "user_b", "user_c", "user_d", "user_e"} {
+		id, err := repo.CreateUser(ctx, &model.CreateUserInput{
+			UniqueName:  name,
+			DisplayName: name,
+			Email:       name + "@example.com",
+		})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	// 公開用のIDは UUIDv7 のため、作成順に並ぶ
+	assert.True(t, slices.IsSorted(ids))
+
+	// 1ページ2件で、カーソルを辿って最後のページまで取得する
+	var got []string
+	var hasNext []bool
+	page := pagination.Page{First: 2}
+	for {
+		users, err := repo.ListUsers(ctx, page.After, page.Limit())
+		require.NoError(t, err)
+		conn := pagination.NewConnection(users, page, func(u *model.User) string { return u.ID })
+		for _, e := range conn.Edges {
+			got = append(got, e.Node.ID)
+		}
+		hasNext = append(hasNext, conn.PageInfo.HasNextPage)
+		if !conn.PageInfo.HasNextPage {
+			break
+		}
+		page.After, err = pagination.DecodeCursor(*conn.PageInfo.EndCursor)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, ids, got)
+	assert.Equal(t, []bool{true, true, false}, hasNext)
+
+	// 残りの件数がちょうど1ページ分の場合は、次のページはない
+	page = pagination.Page{First: 3, After: ids[1]}
+	users, err := repo.ListUsers(ctx, page.After, page.Limit())
+	require.NoError(t, err)
+	conn := pagination.NewConnection(users, page, func(u *model.User) string { return u.ID })
+	require.Len(t, conn.Edges, 3)
+	assert.Equal(t, ids[2], conn.Edges[0].Node.ID)
+	assert.False(t, conn.PageInfo.HasNextPage)
+
+	// 最後のユーザーより後ろには何もない
+	users, err = repo.ListUsers(ctx, ids[4], 10)
+	require.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestUserRepository_GetUsersByIDs(t *testing.T) {
+	ctx := context.Background()
+
+	db, terminate := container.MysqlContainer(t, ctx, container.MySQLcontainerInput())
+	defer terminate()
+	repo := NewUserRepository(db)
+
+	var ids []string
+	for _, name := range []string{"user_a", "user_b", "user_c"} {
+		id, err := repo.CreateUser(ctx, &model.CreateUserInput{
+			UniqueName:  name,
+			DisplayName: name,
+			Email:       name + "@example.com",
+		})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	t.Run("複数のIDをまとめて取得できる", func(t *testing.T) {
+		users, err := repo.GetUsersByIDs(ctx, []string{ids[0], ids[2]})
+		require.NoError(t, err)
+		got := make([]string, len(users))
+		for i, u := range users {
+			got[i] = u.ID
+		}
+		assert.ElementsMatch(t, []string{ids[0], ids[2]}, got)
+	})
+
+	t.Run("存在しないIDは結果に含まれない", func(t *testing.T) {
+		users, err := repo.GetUsersByIDs(ctx, []string{
+			ids[1],
+			"01890a5d-ac96-774b-bcce-b302099a8057",
+			"not-a-uuid",
+		})
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		assert.Equal(t, ids[1], users[0].ID)
+	})
+
+	t.Run("空のIDでは何も返さない", func(t *testing.T) {
+		users, err := repo.GetUsersByIDs(ctx, nil)
+		require.NoError(t, err)
+		assert.Empty(t, users)
+
+		// sqlc.slice は空のスライスを IN (NULL) に置き換える
+		rows, err := dbstore.New(db).GetUsersByPublicIDs(ctx, []string{})
+		require.NoError(t, err)
+		assert.Empty(t, rows)
+	})
+}
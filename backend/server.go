@@ -1,43 +1,220 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
 	"github.com/99designs/gqlgen/graphql/handler/lru"
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/go-sql-driver/mysql"
+	"github.com/redis/go-redis/v9"
 	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/yDog-1/wodun/backend/config"
 	"github.com/yDog-1/wodun/backend/graph"
+	"github.com/yDog-1/wodun/backend/pkg"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/mail"
+	"github.com/yDog-1/wodun/backend/pkg/oidc"
+	"github.com/yDog-1/wodun/backend/pkg/ratelimit"
+	"github.com/yDog-1/wodun/backend/pkg/sms"
+	"github.com/yDog-1/wodun/backend/repository"
+	"github.com/yDog-1/wodun/backend/service"
 )
 
-const defaultPort = "8080"
-
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
+	// CONFIG_FILE が未設定の場合は環境変数だけで設定する
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+
+	db, err := openDB(cfg.MySQL)
+	if err != nil {
+		log.Fatalf("failed to open mysql: %v", err)
+	}
+	defer db.Close()
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: cfg.Redis.Addr,
+	})
+	defer rdb.Close()
+
+	// 依存関係を組み立てる
+	userRepo := repository.NewUserRepository(db)
+	tokenRepo := repository.NewTokenRepository(rdb)
+	magicLinkRepo := repository.NewMagicLinkRepository(rdb)
+	emailChangeRepo := repository.NewEmailChangeRepository(rdb)
+	phoneChangeRepo := repository.NewPhoneChangeRepository(rdb)
+	userService := service.NewUserService(userRepo)
+	keys, err := auth.LoadKeySet(cfg.Token.KeysDir, cfg.Token.SigningKeyID)
+	if err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
+	jwks, err := auth.JWKSHandler(keys)
+	if err != nil {
+		log.Fatalf("failed to create jwks handler: %v", err)
+	}
+	tokenService, err := auth.NewTokenService(tokenRepo, keys, pkg.Clock{}, auth.TokenOptions{
+		Issuer:        cfg.Token.Issuer,
+		Audience:      cfg.Token.Audience,
+		RefreshSecret: []byte(cfg.Token.RefreshSecret),
+		AccessTTL:     cfg.Token.AccessTTL,
+		RefreshTTL:    cfg.Token.RefreshTTL,
+		Leeway:        cfg.Token.ClockSkew,
+	})
+	if err != nil {
+		log.Fatalf("failed to create token service: %v", err)
+	}
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		log.Fatalf("failed to create mailer: %v", err)
+	}
+	smsSender, err := newSMSSender(cfg.SMS)
+	if err != nil {
+		log.Fatalf("failed to create sms sender: %v", err)
+	}
+	magicLinkService, err := service.NewMagicLinkService(
+		userRepo, magicLinkRepo, mailer, smsSender, cfg.MagicLink.URL,
+	)
+	if err != nil {
+		log.Fatalf("failed to create magic link service: %v", err)
+	}
+	emailChangeService, err := service.NewEmailChangeService(userRepo, emailChangeRepo, pkg.Clock{}, mailer, cfg.EmailChange.URL)
+	if err != nil {
+		log.Fatalf("failed to create email change service: %v", err)
+	}
+	phoneChangeService, err := service.NewPhoneChangeService(userRepo, phoneChangeRepo, pkg.Clock{}, smsSender, mailer, cfg.PhoneChange.URL)
+	if err != nil {
+		log.Fatalf("failed to create phone change service: %v", err)
+	}
+
+	googleService, err := newGoogleService(cfg.Google, db, rdb, userService)
+	if err != nil {
+		log.Fatalf("failed to create google login service: %v", err)
 	}
 
-	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{}}))
+	resolver := &graph.Resolver{
+		UserService:        userService,
+		TokenService:       tokenService,
+		MagicLinkService:   magicLinkService,
+		EmailChangeService: emailChangeService,
+		PhoneChangeService: phoneChangeService,
+		GoogleService:      googleService,
+		RateLimiter:        ratelimit.New(rdb),
+	}
+	srv := handler.New(graph.NewExecutableSchema(graph.NewConfig(resolver)))
 
 	srv.AddTransport(transport.Options{})
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
 
 	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+	srv.SetErrorPresenter(graph.ErrorPresenter)
+	srv.SetRecoverFunc(graph.Recover)
 
+	srv.Use(&graph.QueryLimit{
+		MaxDepth:      cfg.GraphQL.MaxDepth,
+		MaxComplexity: cfg.GraphQL.MaxComplexity,
+		Budget:        cfg.GraphQL.CostBudget,
+		Window:        cfg.GraphQL.CostWindow,
+		Limiter:       resolver.RateLimiter,
+	})
 	srv.Use(extension.Introspection{})
 	srv.Use(extension.AutomaticPersistedQuery{
 		Cache: lru.New[string](100),
 	})
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	http.Handle("/query", ratelimit.ClientIPMiddleware(cfg.Server.TrustedProxies)(
+		auth.Middleware(tokenService)(graph.LoaderMiddleware(userService)(srv)),
+	))
+	http.Handle("/.well-known/jwks.json", jwks)
+
+	log.Printf("connect to http://localhost:%s/ for GraphQL playground", cfg.Server.Port)
+	log.Fatal(http.ListenAndServe(":"+cfg.Server.Port, nil))
+}
+
+// MySQLに接続する
+func openDB(c config.MySQL) (*sql.DB, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = c.Addr
+	cfg.DBName = c.Database
+	cfg.ParseTime = true
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// メールの送信方法を選ぶ
+// SMTP のホストが未設定の場合は、送信せずにファイルへ書き出す
+func newMailer(c config.Mail) (mail.Mailer, error) {
+	if c.SMTP.Host == "" {
+		return mail.NewFileMailer(c.Dir, c.From)
+	}
+	return mail.NewSMTPMailer(mail.SMTPConfig{
+		Host:     c.SMTP.Host,
+		Port:     c.SMTP.Port,
+		Username: c.SMTP.Username,
+		Password: c.SMTP.Password,
+		From:     c.From,
+	})
+}
 
-	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+// SMS の送信方法を選ぶ
+// 送信方法が未設定の場合は nil を返し、SMS でのログインと電話番号の変更を無効にする
+// ログへの出力は開発環境でのみ設定できる (config.Validate で確認する)
+func newSMSSender(c config.SMS) (sms.SMSSender, error) {
+	switch c.Sender {
+	case "":
+		log.Printf("sms sender is not configured; sms login and phone changes are disabled")
+		return nil, nil
+	case config.SMSSenderLog:
+		return sms.NewLogSender(nil), nil
+	default:
+		return nil, fmt.Errorf("unknown sms sender: %q", c.Sender)
+	}
+}
+
+// Google ログインを組み立てる
+// クライアントIDが未設定の場合は Google ログインを無効にする
+func newGoogleService(c config.Google, db *sql.DB, rdb *redis.Client, users *service.UserService) (*service.OIDCService, error) {
+	if c.ClientID == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       oidc.GoogleIssuer,
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		RedirectURL:  c.RedirectURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return service.NewOIDCService(
+		"google",
+		provider,
+		repository.NewOIDCStateRepository(rdb),
+		repository.NewIdentityRepository(db),
+		users,
+	), nil
 }
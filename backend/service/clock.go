@@ -0,0 +1,8 @@
+package service
+
+import "time"
+
+// 現在時刻を返す。本番では pkg.Clock を渡し、テストでは時刻を差し替える
+type clock interface {
+	Now() time.Time
+}
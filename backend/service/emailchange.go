@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+	"github.com/yDog-1/wodun/backend/pkg/mail"
+)
+
+// メールアドレスの変更の確認リンクの有効期限 (1時間)
+const emailChangeExpire = time.Hour
+
+type emailChangeStore interface {
+	// 確認待ちの変更を保存する
+	// ユーザーに確認待ちの変更が既にある場合は置き換え、古い確認リンクは無効にする
+	SaveEmailChange(ctx context.Context, userID, hash string, change *model.PendingEmailChange) error
+	GetEmailChange(ctx context.Context, userID string) (*model.PendingEmailChange, bool, error)
+	// 確認リンクのトークンのハッシュから確認待ちの変更を取り出して削除する
+	ConsumeEmailChange(ctx context.Context, hash string) (userID string, change *model.PendingEmailChange, ok bool, err error)
+	DeleteEmailChange(ctx context.Context, userID string) error
+}
+
+var (
+	// 確認リンクが存在しない、使用済み、または期限切れ
+	ErrInvalidEmailChangeLink = apperr.Validation(apperr.Field("token", "email change link is invalid or expired"))
+	// メールアドレスとして解釈できない
+	ErrInvalidEmail = apperr.Validation(apperr.Field("email", "invalid email address"))
+	// 変更後のメールアドレスが現在のメールアドレスと同じ
+	ErrEmailUnchanged = apperr.Validation(apperr.Field("email", "email is the same as the current one"))
+)
+
+// メールアドレスの変更を、変更後のアドレスの所有を確認してから反映する
+type EmailChangeService struct {
+	users   userRepository
+	store   emailChangeStore
+	clock   clock
+	mailer  mail.Mailer
+	baseURL *url.URL
+}
+
+// EmailChangeServiceを生成する
+// baseURL は確認リンクの遷移先で、トークンはクエリパラメータ token として付与される
+func NewEmailChangeService(users userRepository, store emailChangeStore, clock clock, mailer mail.Mailer, baseURL string) (*EmailChangeService, error) {
+	if mailer == nil {
+		return nil, errors.New("mailer is nil")
+	}
+	u, err := parseLinkBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &EmailChangeService{
+		users:   users,
+		store:   store,
+		clock:   clock,
+		mailer:  mailer,
+		baseURL: u,
+	}, nil
+}
+
+// メールアドレスの変更を申請する
+// 変更後のアドレスに確認リンクを送り、乗っ取りに気づけるよう変更前のアドレスにも通知する
+func (s *EmailChangeService) Request(ctx context.Context, userID, email string) (*model.PendingEmailChange, error) {
+	var v validator
+	email = v.email("email", email)
+	if v.err() != nil {
+		return nil, ErrInvalidEmail
+	}
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(email, user.Email) {
+		return nil, ErrEmailUnchanged
+	}
+	if err := s.checkAvailable(ctx, userID, email); err != nil {
+		return nil, err
+	}
+
+	// マジックリンクと同じく、トークンそのものは保存せずハッシュのみを保存する
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	change := &model.PendingEmailChange{
+		Email:     email,
+		ExpiresAt: s.clock.Now().Add(emailChangeExpire).Truncate(time.Second),
+	}
+	if err := s.store.SaveEmailChange(ctx, userID, hashMagicLinkToken(token), change); err != nil {
+		return nil, err
+	}
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "魚丼 メールアドレスの確認",
+		Body: fmt.Sprintf(
+			"%s さん\n\n以下のリンクから、魚丼に登録するメールアドレスの変更を完了してください。\n%s\n\nリンクの有効期限は%d分で、1回だけ使用できます。\n心当たりがない場合は、このメールを破棄してください。\n",
+			user.DisplayName, linkWithToken(s.baseURL, token), int(emailChangeExpire.Minutes()),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "魚丼 メールアドレスの変更の申請",
+		Body: fmt.Sprintf(
+			"%s さん\n\n魚丼に登録するメールアドレスを %s に変更する申請を受け付けました。\n変更は新しいメールアドレスでの確認後に反映されます。\n\n心当たりがない場合は、ログインして変更を取り消し、全ての端末からログアウトしてください。\n",
+			user.DisplayName, email,
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// 確認待ちのメールアドレスの変更を返す
+// 確認待ちの変更がない場合は nil を返す
+func (s *EmailChangeService) Pending(ctx context.Context, userID string) (*model.PendingEmailChange, error) {
+	change, ok, err := s.store.GetEmailChange(ctx, userID)
+	if err != nil || !ok || !s.clock.Now().Before(change.ExpiresAt) {
+		return nil, err
+	}
+	return change, nil
+}
+
+// 確認リンクのトークンを検証し、メールアドレスを変更したユーザーを返す
+func (s *EmailChangeService) Confirm(ctx context.Context, token string) (*model.User, error) {
+	userID, change, ok, err := s.store.ConsumeEmailChange(ctx, hashMagicLinkToken(token))
+	if err != nil {
+		return nil, err
+	}
+	// 有効期限は保存先の失効に頼らず、サービスの時刻で判定する
+	if !ok || !s.clock.Now().Before(change.ExpiresAt) {
+		return nil, ErrInvalidEmailChangeLink
+	}
+	email := change.Email
+	user, err := s.users.GetUserByID(ctx, userID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		// 申請後にユーザーが削除された
+		return nil, ErrInvalidEmailChangeLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 申請から確認までの間に、他のユーザーが同じアドレスを登録している場合がある
+	if err := s.checkAvailable(ctx, userID, email); err != nil {
+		return nil, err
+	}
+	if err := s.users.UpdateUserEmail(ctx, userID, email); err != nil {
+		return nil, err
+	}
+
+	oldEmail := user.Email
+	user.Email = email
+	// 変更は既に反映しているため、通知に失敗してもエラーにはしない
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      oldEmail,
+		Subject: "魚丼 メールアドレスの変更の完了",
+		Body: fmt.Sprintf(
+			"%s さん\n\n魚丼に登録するメールアドレスを %s に変更しました。\n今後のお知らせは新しいメールアドレスに送信します。\n",
+			user.DisplayName, email,
+		),
+	})
+	if err != nil {
+		log.Printf("failed to notify email change to the previous address: %v", err)
+	}
+	return user, nil
+}
+
+// 確認待ちのメールアドレスの変更を取り消す
+// 確認待ちの変更がない場合も成功とする
+func (s *EmailChangeService) Cancel(ctx context.Context, userID string) error {
+	return s.store.DeleteEmailChange(ctx, userID)
+}
+
+// メールアドレスが他のユーザーに使われていないことを確認する
+func (s *EmailChangeService) checkAvailable(ctx context.Context, userID, email string) error {
+	other, err := s.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if other.ID != userID {
+		return domain.ErrEmailTaken
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/mail"
+	"github.com/yDog-1/wodun/backend/service"
+)
+
+func newTestEmailChangeService(t *testing.T) (*service.EmailChangeService, *memoryUserRepository, *fakeClock, *mail.MemoryMailer) {
+	t.Helper()
+	users := newMemoryUserRepository(
+		&model.User{UniqueName: "ydog", DisplayName: "yDog", Email: "ydog@example.com"},
+		&model.User{UniqueName: "other", DisplayName: "other", Email: "other@example.com"},
+	)
+	clock := newFakeClock()
+	mailer := mail.NewMemoryMailer()
+	s, err := service.NewEmailChangeService(users, newMemoryEmailChangeStore(), clock, mailer, "https://wodun.example.com/email/confirm")
+	require.NoError(t, err)
+	return s, users, clock, mailer
+}
+
+func Test_確認リンクでメールアドレスを変更する(t *testing.T) {
+	ctx := context.Background()
+	s, users, _, mailer := newTestEmailChangeService(t)
+
+	change, err := s.Request(ctx, "1", " new@example.com ")
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", change.Email)
+
+	// 確認されるまではメールアドレスを変更しない
+	user, err := users.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "ydog@example.com", user.Email)
+
+	pending, err := s.Pending(ctx, "1")
+	require.NoError(t, err)
+	require.NotNil(t, pending)
+	assert.Equal(t, "new@example.com", pending.Email)
+
+	// 変更後のアドレスに確認リンクを、変更前のアドレスに通知を送る
+	sent := mailer.Sent()
+	require.Len(t, sent, 2)
+	assert.Equal(t, "new@example.com", sent[0].To)
+	assert.Equal(t, "ydog@example.com", sent[1].To)
+	assert.Contains(t, sent[1].Body, "new@example.com")
+	token := tokenFromBody(t, sent[0].Body)
+
+	user, err = s.Confirm(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", user.Email)
+	user, err = users.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", user.Email)
+
+	// 変更の完了を変更前のアドレスに通知する
+	sent = mailer.Sent()
+	require.Len(t, sent, 3)
+	assert.Equal(t, "ydog@example.com", sent[2].To)
+
+	pending, err = s.Pending(ctx, "1")
+	require.NoError(t, err)
+	assert.Nil(t, pending)
+
+	// 同じリンクは2回使えない
+	_, err = s.Confirm(ctx, token)
+	assert.ErrorIs(t, err, service.ErrInvalidEmailChangeLink)
+}
+
+func Test_メールアドレスの変更を取り消す(t *testing.T) {
+	ctx := context.Background()
+	s, users, _, mailer := newTestEmailChangeService(t)
+
+	_, err := s.Request(ctx, "1", "new@example.com")
+	require.NoError(t, err)
+	require.NoError(t, s.Cancel(ctx, "1"))
+
+	_, err = s.Confirm(ctx, tokenFromBody(t, mailer.Sent()[0].Body))
+	assert.ErrorIs(t, err, service.ErrInvalidEmailChangeLink)
+	user, err := users.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "ydog@example.com", user.Email)
+}
+
+func Test_新しい申請で古い確認リンクを無効にする(t *testing.T) {
+	ctx := context.Background()
+	s, users, _, mailer := newTestEmailChangeService(t)
+
+	_, err := s.Request(ctx, "1", "first@example.com")
+	require.NoError(t, err)
+	_, err = s.Request(ctx, "1", "second@example.com")
+	require.NoError(t, err)
+	sent := mailer.Sent()
+	require.Len(t, sent, 4)
+
+	_, err = s.Confirm(ctx, tokenFromBody(t, sent[0].Body))
+	assert.ErrorIs(t, err, service.ErrInvalidEmailChangeLink)
+
+	_, err = s.Confirm(ctx, tokenFromBody(t, sent[2].Body))
+	require.NoError(t, err)
+	user, err := users.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "second@example.com", user.Email)
+}
+
+func Test_期限切れの確認リンクは拒否する(t *testing.T) {
+	ctx := context.Background()
+	s, _, clock, mailer := newTestEmailChangeService(t)
+
+	change, err := s.Request(ctx, "1", "new@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(time.Hour), change.ExpiresAt)
+
+	// 有効期限の直前までは確認待ちとして扱う
+	clock.Advance(time.Hour - time.Second)
+	pending, err := s.Pending(ctx, "1")
+	require.NoError(t, err)
+	assert.NotNil(t, pending)
+
+	clock.Advance(time.Second)
+
+	pending, err = s.Pending(ctx, "1")
+	require.NoError(t, err)
+	assert.Nil(t, pending)
+	_, err = s.Confirm(ctx, tokenFromBody(t, mailer.Sent()[0].Body))
+	assert.ErrorIs(t, err, service.ErrInvalidEmailChangeLink)
+}
+
+func Test_メールアドレスの変更の申請を拒否する(t *testing.T) {
+	ctx := context.Background()
+	s, _, _, mailer := newTestEmailChangeService(t)
+
+	tests := []struct {
+		name  string
+		email string
+		want  error
+	}{
+		{"現在と同じアドレス", "YDOG@example.com", service.ErrEmailUnchanged},
+		{"他のユーザーのアドレス", "other@example.com", domain.ErrEmailTaken},
+		{"アドレスとして解釈できない", "not an email", service.ErrInvalidEmail},
+		{"表示名付きの形式", "New <new@example.com>", service.ErrInvalidEmail},
+		{"ヘッダーの差し込み", "new@example.com\r\nBcc: evil@example.com", service.ErrInvalidEmail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Request(ctx, "1", tt.email)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+	assert.Empty(t, mailer.Sent())
+}
+
+func Test_確認までに他のユーザーが登録したアドレスには変更しない(t *testing.T) {
+	ctx := context.Background()
+	s, users, _, mailer := newTestEmailChangeService(t)
+
+	_, err := s.Request(ctx, "1", "new@example.com")
+	require.NoError(t, err)
+	_, err = users.CreateUser(ctx, &model.CreateUserInput{UniqueName: "late", DisplayName: "late", Email: "new@example.com"})
+	require.NoError(t, err)
+
+	_, err = s.Confirm(ctx, tokenFromBody(t, mailer.Sent()[0].Body))
+	assert.ErrorIs(t, err, domain.ErrEmailTaken)
+	user, err := users.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "ydog@example.com", user.Email)
+}
@@ -0,0 +1,406 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/confusable"
+)
+
+// メモリ上でユーザーを保持する userRepository
+type memoryUserRepository struct {
+	mu     sync.Mutex
+	users  map[string]*model.User
+	logs   []*model.UserAuditLog
+	nextID int
+}
+
+func newMemoryUserRepository(users ...*model.User) *memoryUserRepository {
+	r := &memoryUserRepository{users: map[string]*model.User{}}
+	for _, u := range users {
+		r.nextID++
+		u.ID = fmt.Sprint(r.nextID)
+		r.users[u.ID] = u
+	}
+	return r
+}
+
+func (r *memoryUserRepository) find(match func(*model.User) bool) (*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if match(u) {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (r *memoryUserRepository) GetUser(ctx context.Context, uniqueName string) (*model.User, error) {
+	return r.find(func(u *model.User) bool { return u.UniqueName == uniqueName })
+}
+
+func (r *memoryUserRepository) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	return r.find(func(u *model.User) bool { return u.ID == id })
+}
+
+func (r *memoryUserRepository) GetUsersByIDs(ctx context.Context, ids []string) ([]*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res []*model.User
+	for _, id := range ids {
+		if u, ok := r.users[id]; ok {
+			c := *u
+			res = append(res, &c)
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryUserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.find(func(u *model.User) bool { return u.Email == email })
+}
+
+func (r *memoryUserRepository) GetUserByConfusableName(ctx context.Context, uniqueName string) (*model.User, error) {
+	skeleton := confusable.Skeleton(uniqueName)
+	return r.find(func(u *model.User) bool { return confusable.Skeleton(u.UniqueName) == skeleton })
+}
+
+func (r *memoryUserRepository) GetUserByPhone(ctx context.Context, phone string) (*model.User, error) {
+	return r.find(func(u *model.User) bool { return u.Phone != nil && *u.Phone == phone })
+}
+
+func (r *memoryUserRepository) ListUsers(ctx context.Context, after string, limit int) ([]*model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res []*model.User
+	for _, u := range r.users {
+		if u.ID > after {
+			c := *u
+			res = append(res, &c)
+		}
+	}
+	slices.SortFunc(res, func(a, b *model.User) int { return strings.Compare(a.ID, b.ID) })
+	return res[:min(limit, len(res))], nil
+}
+
+func (r *memoryUserRepository) CreateUser(ctx context.Context, input *model.CreateUserInput) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	id := fmt.Sprint(r.nextID)
+	r.users[id] = &model.User{
+		ID:          id,
+		UniqueName:  input.UniqueName,
+		DisplayName: input.DisplayName,
+		Email:       input.Email,
+		Role:        auth.RoleMember,
+	}
+	return id, nil
+}
+
+func (r *memoryUserRepository) UpdateUser(ctx context.Context, id string, input *model.UpdateUserInput) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return nil
+	}
+	if input.DisplayName != nil {
+		u.DisplayName = *input.DisplayName
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateUserEmail(ctx context.Context, id string, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[id]; ok {
+		u.Email = email
+		u.EmailVerified = true
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) VerifyUserEmail(ctx context.Context, id string, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[id]; ok && u.Email == email {
+		u.EmailVerified = true
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateUserPhone(ctx context.Context, id string, phone *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for otherID, u := range r.users {
+		if phone != nil && otherID != id && u.Phone != nil && *u.Phone == *phone {
+			return domain.ErrPhoneTaken
+		}
+	}
+	if u, ok := r.users[id]; ok {
+		u.Phone = phone
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateUserRole(ctx context.Context, id string, role auth.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[id]; ok {
+		u.Role = role
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) RenameUser(ctx context.Context, actorID, id, uniqueName, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	r.logs = append(r.logs, &model.UserAuditLog{
+		ID:        fmt.Sprint(len(r.logs) + 1),
+		ActorID:   &actorID,
+		UserID:    id,
+		Action:    model.UserAuditActionRename,
+		OldValue:  u.UniqueName,
+		NewValue:  uniqueName,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+	u.UniqueName = uniqueName
+	return nil
+}
+
+func (r *memoryUserRepository) ListUserAuditLogs(ctx context.Context, id string) ([]*model.UserAuditLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var res []*model.UserAuditLog
+	for i := len(r.logs) - 1; i >= 0; i-- {
+		if r.logs[i].UserID == id {
+			res = append(res, r.logs[i])
+		}
+	}
+	return res, nil
+}
+
+func (r *memoryUserRepository) DeleteUser(ctx context.Context, uniqueName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, u := range r.users {
+		if u.UniqueName == uniqueName {
+			delete(r.users, id)
+		}
+	}
+	return nil
+}
+
+// メモリ上でマジックリンクを保持する magicLinkStore
+// 有効期限は扱わない
+type memoryMagicLinkStore struct {
+	mu    sync.Mutex
+	links map[string]string
+}
+
+func newMemoryMagicLinkStore() *memoryMagicLinkStore {
+	return &memoryMagicLinkStore{links: map[string]string{}}
+}
+
+func (s *memoryMagicLinkStore) SaveMagicLink(ctx context.Context, hash, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links[hash] = value
+	return nil
+}
+
+func (s *memoryMagicLinkStore) ConsumeMagicLink(ctx context.Context, hash string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.links[hash]
+	delete(s.links, hash)
+	return v, ok, nil
+}
+
+// メモリ上で外部アカウントの紐づけを保持する identityRepository
+type memoryIdentityRepository struct {
+	mu    sync.Mutex
+	links map[string]string
+}
+
+func newMemoryIdentityRepository() *memoryIdentityRepository {
+	return &memoryIdentityRepository{links: map[string]string{}}
+}
+
+func (r *memoryIdentityRepository) GetUserIDByIdentity(ctx context.Context, provider, subject string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.links[provider+":"+subject]
+	if !ok {
+		return "", domain.ErrOIDCAccountNotFound
+	}
+	return id, nil
+}
+
+func (r *memoryIdentityRepository) LinkIdentity(ctx context.Context, userID, provider, subject, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.links[provider+":"+subject] = userID
+	return nil
+}
+
+// メモリ上で認可リクエストの state を保持する oidcStateStore
+type memoryOIDCStateStore struct {
+	mu     sync.Mutex
+	states map[string][2]string
+}
+
+func newMemoryOIDCStateStore() *memoryOIDCStateStore {
+	return &memoryOIDCStateStore{states: map[string][2]string{}}
+}
+
+func (s *memoryOIDCStateStore) SaveOIDCState(ctx context.Context, state, nonce, verifier string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state] = [2]string{nonce, verifier}
+	return nil
+}
+
+func (s *memoryOIDCStateStore) ConsumeOIDCState(ctx context.Context, state string) (string, string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.states[state]
+	delete(s.states, state)
+	return v[0], v[1], ok, nil
+}
+
+// メモリ上で確認待ちのメールアドレスの変更を保持する emailChangeStore
+// 有効期限は扱わない
+type memoryEmailChangeStore struct {
+	mu      sync.Mutex
+	changes map[string]memoryEmailChange
+}
+
+type memoryEmailChange struct {
+	hash   string
+	change model.PendingEmailChange
+}
+
+func newMemoryEmailChangeStore() *memoryEmailChangeStore {
+	return &memoryEmailChangeStore{changes: map[string]memoryEmailChange{}}
+}
+
+func (s *memoryEmailChangeStore) SaveEmailChange(ctx context.Context, userID, hash string, change *model.PendingEmailChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes[userID] = memoryEmailChange{hash: hash, change: *change}
+	return nil
+}
+
+func (s *memoryEmailChangeStore) GetEmailChange(ctx context.Context, userID string) (*model.PendingEmailChange, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.changes[userID]
+	if !ok {
+		return nil, false, nil
+	}
+	return &c.change, true, nil
+}
+
+func (s *memoryEmailChangeStore) ConsumeEmailChange(ctx context.Context, hash string) (string, *model.PendingEmailChange, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for userID, c := range s.changes {
+		if c.hash == hash {
+			delete(s.changes, userID)
+			return userID, &c.change, true, nil
+		}
+	}
+	return "", nil, false, nil
+}
+
+func (s *memoryEmailChangeStore) DeleteEmailChange(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.changes, userID)
+	return nil
+}
+
+// メモリ上で確認待ちの電話番号の変更を保持する phoneChangeStore
+// 有効期限は扱わない
+type memoryPhoneChangeStore struct {
+	mu      sync.Mutex
+	changes map[string]memoryPhoneChange
+}
+
+type memoryPhoneChange struct {
+	hash   string
+	change model.PendingPhoneChange
+}
+
+func newMemoryPhoneChangeStore() *memoryPhoneChangeStore {
+	return &memoryPhoneChangeStore{changes: map[string]memoryPhoneChange{}}
+}
+
+func (s *memoryPhoneChangeStore) SavePhoneChange(ctx context.Context, userID, hash string, change *model.PendingPhoneChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes[userID] = memoryPhoneChange{hash: hash, change: *change}
+	return nil
+}
+
+func (s *memoryPhoneChangeStore) GetPhoneChange(ctx context.Context, userID string) (*model.PendingPhoneChange, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.changes[userID]
+	if !ok {
+		return nil, false, nil
+	}
+	return &c.change, true, nil
+}
+
+func (s *memoryPhoneChangeStore) ConsumePhoneChange(ctx context.Context, hash string) (string, *model.PendingPhoneChange, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for userID, c := range s.changes {
+		if c.hash == hash {
+			delete(s.changes, userID)
+			return userID, &c.change, true, nil
+		}
+	}
+	return "", nil, false, nil
+}
+
+func (s *memoryPhoneChangeStore) DeletePhoneChange(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.changes, userID)
+	return nil
+}
+
+// 任意に時刻を進められる clock
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+	"github.com/yDog-1/wodun/backend/pkg/mail"
+	"github.com/yDog-1/wodun/backend/pkg/sms"
+)
+
+// マジックリンクの有効期限 (15分)
+const magicLinkExpire = 15 * time.Minute
+
+type magicLinkStore interface {
+	SaveMagicLink(ctx context.Context, hash, value string, ttl time.Duration) error
+	ConsumeMagicLink(ctx context.Context, hash string) (string, bool, error)
+}
+
+// マジックリンクが存在しない、使用済み、または期限切れ
+var ErrInvalidMagicLink = apperr.Unauthenticated("magic link is invalid or expired")
+
+// マジックリンクで認証する対象
+type magicLinkTarget struct {
+	UserID string `json:"userId"`
+	// リンクを送ったメールアドレス。リンクを使えばアドレスの所有も確認できる
+	// SMS で送った場合は空にする
+	Email string `json:"email,omitempty"`
+}
+
+type MagicLinkService struct {
+	users   userRepository
+	store   magicLinkStore
+	mailer  mail.Mailer
+	sms     sms.SMSSender
+	baseURL *url.URL
+}
+
+// MagicLinkServiceを生成する
+// baseURL はリンクの遷移先で、トークンはクエリパラメータ token として付与される
+// sender が nil の場合は SMS でのログインを無効にする
+func NewMagicLinkService(users userRepository, store magicLinkStore, mailer mail.Mailer, sender sms.SMSSender, baseURL string) (*MagicLinkService, error) {
+	if mailer == nil {
+		return nil, errors.New("mailer is nil")
+	}
+	u, err := parseLinkBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &MagicLinkService{
+		users:   users,
+		store:   store,
+		mailer:  mailer,
+		sms:     sender,
+		baseURL: u,
+	}, nil
+}
+
+// メールアドレスにマジックリンクを送信する
+// 登録の有無を推測されないよう、未登録のアドレスでもエラーにしない
+func (s *MagicLinkService) SendEmail(ctx context.Context, email string) error {
+	user, err := s.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link, err := s.issue(ctx, magicLinkTarget{UserID: user.ID, Email: user.Email})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "魚丼 ログインリンク",
+		Body: fmt.Sprintf(
+			"%s さん\n\n以下のリンクから魚丼にログインしてください。\n%s\n\nリンクの有効期限は%d分で、1回だけ使用できます。\n心当たりがない場合は、このメールを破棄してください。\n",
+			user.DisplayName, link, int(magicLinkExpire.Minutes()),
+		),
+	})
+}
+
+// 電話番号にSMSでマジックリンクを送信する
+// メールと同じく、未登録の番号でもエラーにしない
+func (s *MagicLinkService) SendSMS(ctx context.Context, phone string) error {
+	if s.sms == nil {
+		return ErrSMSDisabled
+	}
+	normalized, err := NormalizePhoneNumber(phone)
+	if err != nil {
+		return err
+	}
+	user, err := s.users.GetUserByPhone(ctx, normalized)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link, err := s.issue(ctx, magicLinkTarget{UserID: user.ID})
+	if err != nil {
+		return err
+	}
+	// SMSは文字数の制約があるため、本文は短くする
+	return s.sms.Send(ctx, sms.Message{
+		To:   normalized,
+		Body: fmt.Sprintf("魚丼 ログインリンク (%d分間有効)\n%s", int(magicLinkExpire.Minutes()), link),
+	})
+}
+
+// マジックリンクのトークンを検証し、認証されたユーザーを返す
+// メールで送ったリンクの場合は、送信先のメールアドレスを確認済みにする
+func (s *MagicLinkService) Verify(ctx context.Context, token string) (*model.User, error) {
+	value, ok, err := s.store.ConsumeMagicLink(ctx, hashMagicLinkToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMagicLink
+	}
+	var target magicLinkTarget
+	if err := json.Unmarshal([]byte(value), &target); err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+	user, err := s.users.GetUserByID(ctx, target.UserID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		// リンクの発行後にユーザーが削除された
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	if target.Email != "" && target.Email == user.Email && !user.EmailVerified {
+		if err := s.users.VerifyUserEmail(ctx, user.ID, target.Email); err != nil {
+			return nil, err
+		}
+		user.EmailVerified = true
+	}
+	return user, nil
+}
+
+// ユーザーに対するマジックリンクを発行して、リンクのURLを返す
+// トークンそのものは保存せず、ハッシュのみを保存する
+func (s *MagicLinkService) issue(ctx context.Context, target magicLinkTarget) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	value, err := json.Marshal(target)
+	if err != nil {
+		return "", err
+	}
+	if err := s.store.SaveMagicLink(ctx, hashMagicLinkToken(token), string(value), magicLinkExpire); err != nil {
+		return "", err
+	}
+	return linkWithToken(s.baseURL, token), nil
+}
+
+// リンクの遷移先となるURLを解釈する
+func parseLinkBaseURL(baseURL string) (*url.URL, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() {
+		return nil, fmt.Errorf("link base url must be absolute: %q", baseURL)
+	}
+	return u, nil
+}
+
+// リンクの遷移先にトークンをクエリパラメータ token として付与する
+func linkWithToken(base *url.URL, token string) string {
+	u := *base
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// 推測できない十分な長さのランダムな文字列を生成する
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// トークンのハッシュを計算する
+// トークンは十分なエントロピーを持つため、低速なハッシュ関数は不要である
+func hashMagicLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,136 @@
+package service_test
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg"
+	"github.com/yDog-1/wodun/backend/pkg/mail"
+	"github.com/yDog-1/wodun/backend/pkg/sms"
+	"github.com/yDog-1/wodun/backend/service"
+)
+
+// メール本文からリンクのトークンを取り出す
+func tokenFromBody(t *testing.T, body string) string {
+	t.Helper()
+	link := regexp.MustCompile(`https?://\S+`).FindString(body)
+	require.NotEmpty(t, link, "mail body should contain a link")
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	return u.Query().Get("token")
+}
+
+func Test_マジックリンクでログインする(t *testing.T) {
+	ctx := context.Background()
+	users := newMemoryUserRepository(&model.User{
+		UniqueName:  "ydog",
+		DisplayName: "yDog",
+		Email:       "ydog@example.com",
+	})
+	store := newMemoryMagicLinkStore()
+	mailer := mail.NewMemoryMailer()
+	s, err := service.NewMagicLinkService(users, store, mailer, sms.NewMemorySender(), "https://wodun.example.com/login")
+	require.NoError(t, err)
+
+	err = s.SendEmail(ctx, "ydog@example.com")
+	require.NoError(t, err)
+
+	sent := mailer.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "ydog@example.com", sent[0].To)
+	token := tokenFromBody(t, sent[0].Body)
+	require.NotEmpty(t, token)
+
+	// トークンそのものは保存されない
+	for hash := range store.links {
+		assert.NotEqual(t, token, hash)
+	}
+
+	user, err := s.Verify(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "ydog", user.UniqueName)
+	// メールで届いたリンクを使えたため、アドレスの所有を確認できた
+	assert.True(t, user.EmailVerified)
+	stored, err := users.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.EmailVerified)
+
+	// 同じリンクは2回使えない
+	_, err = s.Verify(ctx, token)
+	assert.ErrorIs(t, err, service.ErrInvalidMagicLink)
+}
+
+func Test_未登録のメールアドレスにはマジックリンクを送らない(t *testing.T) {
+	ctx := context.Background()
+	mailer := mail.NewMemoryMailer()
+	s, err := service.NewMagicLinkService(newMemoryUserRepository(), newMemoryMagicLinkStore(), mailer, sms.NewMemorySender(), "https://wodun.example.com/login")
+	require.NoError(t, err)
+
+	err = s.SendEmail(ctx, "unknown@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, mailer.Sent())
+}
+
+func Test_不正なマジックリンクは拒否する(t *testing.T) {
+	ctx := context.Background()
+	s, err := service.NewMagicLinkService(newMemoryUserRepository(), newMemoryMagicLinkStore(), mail.NewMemoryMailer(), sms.NewMemorySender(), "https://wodun.example.com/login")
+	require.NoError(t, err)
+
+	_, err = s.Verify(ctx, "invalid-token")
+	assert.ErrorIs(t, err, service.ErrInvalidMagicLink)
+}
+
+func Test_SMSのマジックリンクでログインする(t *testing.T) {
+	ctx := context.Background()
+	users := newMemoryUserRepository(&model.User{
+		UniqueName:  "ydog",
+		DisplayName: "yDog",
+		Email:       "ydog@example.com",
+		Phone:       pkg.PtrStr("+819012345678"),
+	})
+	sender := sms.NewMemorySender()
+	s, err := service.NewMagicLinkService(users, newMemoryMagicLinkStore(), mail.NewMemoryMailer(), sender, "https://wodun.example.com/login")
+	require.NoError(t, err)
+
+	// 国内形式で入力しても E.164 形式で照合される
+	err = s.SendSMS(ctx, "090-1234-5678")
+	require.NoError(t, err)
+
+	sent := sender.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "+819012345678", sent[0].To)
+
+	user, err := s.Verify(ctx, tokenFromBody(t, sent[0].Body))
+	require.NoError(t, err)
+	assert.Equal(t, "ydog", user.UniqueName)
+	// SMS のリンクではメールアドレスの所有を確認できない
+	assert.False(t, user.EmailVerified)
+
+	// 未登録の番号には送らない
+	err = s.SendSMS(ctx, "080-0000-1111")
+	require.NoError(t, err)
+	assert.Len(t, sender.Sent(), 1)
+
+	// 電話番号として解釈できない入力は拒否する
+	err = s.SendSMS(ctx, "not a phone")
+	assert.ErrorIs(t, err, service.ErrInvalidPhoneNumber)
+}
+
+func Test_SMSを送信できない場合はSMSのマジックリンクを送らない(t *testing.T) {
+	users := newMemoryUserRepository(&model.User{
+		UniqueName:  "ydog",
+		DisplayName: "yDog",
+		Email:       "ydog@example.com",
+		Phone:       pkg.PtrStr("+819012345678"),
+	})
+	s, err := service.NewMagicLinkService(users, newMemoryMagicLinkStore(), mail.NewMemoryMailer(), nil, "https://wodun.example.com/login")
+	require.NoError(t, err)
+
+	err = s.SendSMS(context.Background(), "090-1234-5678")
+	assert.ErrorIs(t, err, service.ErrSMSDisabled)
+}
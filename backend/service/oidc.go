@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+	"github.com/yDog-1/wodun/backend/pkg/oidc"
+)
+
+// 認可リクエストの有効期限 (10分)
+const oidcStateExpire = 10 * time.Minute
+
+type oidcProvider interface {
+	AuthCodeURL(state, nonce, verifier string) string
+	Exchange(ctx context.Context, code, verifier, nonce string) (*oidc.Claims, error)
+}
+
+type oidcStateStore interface {
+	SaveOIDCState(ctx context.Context, state, nonce, verifier string, ttl time.Duration) error
+	ConsumeOIDCState(ctx context.Context, state string) (nonce, verifier string, ok bool, err error)
+}
+
+type identityRepository interface {
+	GetUserIDByIdentity(ctx context.Context, provider, subject string) (string, error)
+	LinkIdentity(ctx context.Context, userID, provider, subject, email string) error
+}
+
+var (
+	// state が存在しない、使用済み、または期限切れ
+	ErrInvalidOIDCState = apperr.Unauthenticated("oidc state is invalid or expired")
+	// 外部アカウントのメールアドレスが確認されていない
+	ErrOIDCEmailNotVerified = apperr.Forbidden("email of the identity is not verified")
+	// メールアドレスが一致するユーザーが、そのアドレスの所有を確認していない
+	// 他人のアドレスで先に登録したアカウントに紐づけないよう、マジックリンクでのログインを先に求める
+	ErrOIDCAccountNotLinkable = apperr.Conflict("email", "email is used by an account that has not verified it")
+)
+
+type OIDCService struct {
+	provider   string
+	oidc       oidcProvider
+	states     oidcStateStore
+	identities identityRepository
+	users      *UserService
+}
+
+// OIDCServiceを生成する
+// provider は user_identities に保存するプロバイダー名 ("google" など)
+func NewOIDCService(provider string, p oidcProvider, states oidcStateStore, identities identityRepository, users *UserService) *OIDCService {
+	return &OIDCService{
+		provider:   provider,
+		oidc:       p,
+		states:     states,
+		identities: identities,
+		users:      users,
+	}
+}
+
+// ログインを開始して、認可エンドポイントの URL を返す
+func (s *OIDCService) Start(ctx context.Context) (string, error) {
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier := oidc.GenerateVerifier()
+	if err := s.states.SaveOIDCState(ctx, state, nonce, verifier, oidcStateExpire); err != nil {
+		return "", err
+	}
+	return s.oidc.AuthCodeURL(state, nonce, verifier), nil
+}
+
+// 認可コードで外部アカウントを認証し、紐づくユーザーを返す
+// 紐づくユーザーがいない場合は、確認済みのメールアドレスが一致するユーザーに紐づける
+// 一致するユーザーがメールアドレスの所有を確認していない場合は紐づけない
+// それもいない場合は、signup が指定されていれば新しいユーザーを作成する
+func (s *OIDCService) Login(ctx context.Context, code, state string, signup *model.OAuthSignupInput) (*model.User, error) {
+	nonce, verifier, ok, err := s.states.ConsumeOIDCState(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidOIDCState
+	}
+	claims, err := s.oidc.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// 紐づけ済みの外部アカウント
+	id, err := s.identities.GetUserIDByIdentity(ctx, s.provider, claims.Subject)
+	if err == nil {
+		return s.users.GetUserByID(ctx, id)
+	}
+	if !errors.Is(err, domain.ErrOIDCAccountNotFound) {
+		return nil, err
+	}
+
+	// 未確認のメールアドレスで紐づけると、他人のアカウントを乗っ取れてしまう
+	if !claims.EmailVerified || claims.Email == "" {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	user, err := s.users.GetUserByEmail(ctx, claims.Email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		if signup == nil {
+			return nil, domain.ErrOIDCAccountNotFound
+		}
+		user, err = s.createUser(ctx, claims, signup)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return nil, ErrOIDCAccountNotLinkable
+	}
+
+	if err := s.identities.LinkIdentity(ctx, user.ID, s.provider, claims.Subject, claims.Email); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// 外部アカウントのメールアドレスで新しいユーザーを作成する
+func (s *OIDCService) createUser(ctx context.Context, claims *oidc.Claims, signup *model.OAuthSignupInput) (*model.User, error) {
+	id, err := s.users.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  signup.UniqueName,
+		DisplayName: signup.DisplayName,
+		Email:       claims.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 外部アカウントで所有を確認したアドレスで登録したため、確認済みにする
+	if err := s.users.VerifyEmail(ctx, id, claims.Email); err != nil {
+		return nil, err
+	}
+	return s.users.GetUserByID(ctx, id)
+}
@@ -0,0 +1,159 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/oidc"
+	"github.com/yDog-1/wodun/backend/service"
+)
+
+// 認可 URL に含めた nonce と PKCE のベリファイアを確認する oidcProvider
+type fakeOIDCProvider struct {
+	claims   oidc.Claims
+	nonce    string
+	verifier string
+}
+
+func (p *fakeOIDCProvider) AuthCodeURL(state, nonce, verifier string) string {
+	p.nonce = nonce
+	p.verifier = verifier
+	return "https://idp.example.com/authorize?state=" + url.QueryEscape(state)
+}
+
+func (p *fakeOIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*oidc.Claims, error) {
+	if code != "valid-code" || verifier != p.verifier || nonce != p.nonce {
+		return nil, errors.New("invalid grant")
+	}
+	c := p.claims
+	return &c, nil
+}
+
+// ログインを開始して state を取り出す
+func startOIDCLogin(t *testing.T, s *service.OIDCService) string {
+	t.Helper()
+	authURL, err := s.Start(context.Background())
+	require.NoError(t, err)
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	return u.Query().Get("state")
+}
+
+func newTestOIDCService(claims oidc.Claims, users ...*model.User) (*service.OIDCService, *memoryIdentityRepository) {
+	identities := newMemoryIdentityRepository()
+	s := service.NewOIDCService(
+		"google",
+		&fakeOIDCProvider{claims: claims},
+		newMemoryOIDCStateStore(),
+		identities,
+		service.NewUserService(newMemoryUserRepository(users...)),
+	)
+	return s, identities
+}
+
+var googleClaims = oidc.Claims{
+	Subject:       "google-sub-123",
+	Email:         "ydog@example.com",
+	EmailVerified: true,
+	Name:          "yDog",
+}
+
+func Test_Googleアカウントを既存ユーザーに紐づける(t *testing.T) {
+	ctx := context.Background()
+	s, identities := newTestOIDCService(googleClaims, &model.User{
+		UniqueName:    "ydog",
+		DisplayName:   "yDog",
+		Email:         "ydog@example.com",
+		EmailVerified: true,
+	})
+
+	user, err := s.Login(ctx, "valid-code", startOIDCLogin(t, s), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ydog", user.UniqueName)
+
+	id, err := identities.GetUserIDByIdentity(ctx, "google", "google-sub-123")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, id)
+
+	// 2回目以降は紐づけからユーザーを引く
+	user, err = s.Login(ctx, "valid-code", startOIDCLogin(t, s), nil)
+	require.NoError(t, err)
+	assert.Equal(t, id, user.ID)
+}
+
+func Test_Googleアカウントで新規登録する(t *testing.T) {
+	ctx := context.Background()
+	s, identities := newTestOIDCService(googleClaims)
+
+	// 未登録で signup がない場合は登録を促す
+	_, err := s.Login(ctx, "valid-code", startOIDCLogin(t, s), nil)
+	assert.ErrorIs(t, err, domain.ErrOIDCAccountNotFound)
+
+	user, err := s.Login(ctx, "valid-code", startOIDCLogin(t, s), &model.OAuthSignupInput{
+		UniqueName:  "ydog",
+		DisplayName: "yDog",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ydog", user.UniqueName)
+	assert.Equal(t, "ydog@example.com", user.Email)
+	assert.True(t, user.EmailVerified)
+
+	id, err := identities.GetUserIDByIdentity(ctx, "google", "google-sub-123")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, id)
+}
+
+func Test_未確認のメールアドレスでは紐づけない(t *testing.T) {
+	claims := googleClaims
+	claims.EmailVerified = false
+	s, _ := newTestOIDCService(claims, &model.User{
+		UniqueName:  "ydog",
+		DisplayName: "yDog",
+		Email:       "ydog@example.com",
+	})
+
+	_, err := s.Login(context.Background(), "valid-code", startOIDCLogin(t, s), nil)
+	assert.ErrorIs(t, err, service.ErrOIDCEmailNotVerified)
+}
+
+// 他人のメールアドレスで先に登録したアカウントに、本人の Google アカウントを紐づけない
+func Test_メールアドレスを確認していないユーザーには紐づけない(t *testing.T) {
+	ctx := context.Background()
+	s, identities := newTestOIDCService(googleClaims, &model.User{
+		UniqueName:  "attacker",
+		DisplayName: "attacker",
+		Email:       "ydog@example.com",
+	})
+
+	_, err := s.Login(ctx, "valid-code", startOIDCLogin(t, s), nil)
+	assert.ErrorIs(t, err, service.ErrOIDCAccountNotLinkable)
+
+	_, err = identities.GetUserIDByIdentity(ctx, "google", "google-sub-123")
+	assert.ErrorIs(t, err, domain.ErrOIDCAccountNotFound)
+}
+
+func Test_stateは1回しか使えない(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestOIDCService(googleClaims, &model.User{
+		UniqueName:    "ydog",
+		DisplayName:   "yDog",
+		Email:         "ydog@example.com",
+		EmailVerified: true,
+	})
+
+	state := startOIDCLogin(t, s)
+	_, err := s.Login(ctx, "valid-code", state, nil)
+	require.NoError(t, err)
+
+	_, err = s.Login(ctx, "valid-code", state, nil)
+	assert.ErrorIs(t, err, service.ErrInvalidOIDCState)
+
+	_, err = s.Login(ctx, "valid-code", "unknown-state", nil)
+	assert.ErrorIs(t, err, service.ErrInvalidOIDCState)
+}
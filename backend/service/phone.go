@@ -0,0 +1,29 @@
+package service
+
+import (
+	"github.com/nyaruka/phonenumbers"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+)
+
+// 国番号が省略された電話番号は日本の番号として扱う
+const defaultPhoneRegion = "JP"
+
+var (
+	// 電話番号として解釈できない
+	ErrInvalidPhoneNumber = apperr.Validation(apperr.Field("phone", "invalid phone number"))
+	// SMS の送信方法が設定されていない
+	ErrSMSDisabled = apperr.Forbidden("sms is not configured")
+)
+
+// 電話番号を E.164 形式に正規化する
+// "090-1234-5678" や "+81 90 1234 5678" はいずれも "+819012345678" になる
+func NormalizePhoneNumber(phone string) (string, error) {
+	num, err := phonenumbers.Parse(phone, defaultPhoneRegion)
+	if err != nil {
+		return "", ErrInvalidPhoneNumber
+	}
+	if !phonenumbers.IsValidNumber(num) {
+		return "", ErrInvalidPhoneNumber
+	}
+	return phonenumbers.Format(num, phonenumbers.E164), nil
+}
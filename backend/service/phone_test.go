@@ -0,0 +1,37 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/service"
+)
+
+func Test_電話番号をE164形式に正規化する(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"ハイフン区切りの国内番号", "090-1234-5678", "+819012345678"},
+		{"区切りなしの国内番号", "09012345678", "+819012345678"},
+		{"国番号付き", "+81 90 1234 5678", "+819012345678"},
+		{"全角数字", "０９０１２３４５６７８", "+819012345678"},
+		{"海外の番号", "+1 650-253-0000", "+16502530000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.NormalizePhoneNumber(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_不正な電話番号は拒否する(t *testing.T) {
+	for _, input := range []string{"", "abc", "090-1234", "+81 00 0000 0000"} {
+		_, err := service.NormalizePhoneNumber(input)
+		assert.ErrorIs(t, err, service.ErrInvalidPhoneNumber, input)
+	}
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+	"github.com/yDog-1/wodun/backend/pkg/mail"
+	"github.com/yDog-1/wodun/backend/pkg/sms"
+)
+
+// 電話番号の変更の確認リンクの有効期限 (15分)
+// SMSは第三者の目に触れやすいため、メールアドレスの変更より短くする
+const phoneChangeExpire = 15 * time.Minute
+
+type phoneChangeStore interface {
+	// 確認待ちの変更を保存する
+	// ユーザーに確認待ちの変更が既にある場合は置き換え、古い確認リンクは無効にする
+	SavePhoneChange(ctx context.Context, userID, hash string, change *model.PendingPhoneChange) error
+	GetPhoneChange(ctx context.Context, userID string) (*model.PendingPhoneChange, bool, error)
+	// 確認リンクのトークンのハッシュから確認待ちの変更を取り出して削除する
+	ConsumePhoneChange(ctx context.Context, hash string) (userID string, change *model.PendingPhoneChange, ok bool, err error)
+	DeletePhoneChange(ctx context.Context, userID string) error
+}
+
+var (
+	// 確認リンクが存在しない、使用済み、または期限切れ
+	ErrInvalidPhoneChangeLink = apperr.Validation(apperr.Field("token", "phone change link is invalid or expired"))
+	// 変更後の電話番号が現在の電話番号と同じ
+	ErrPhoneUnchanged = apperr.Validation(apperr.Field("phone", "phone number is the same as the current one"))
+)
+
+// 電話番号の変更を、変更後の番号の所有を確認してから反映する
+// SMSでのログインに使われるため、確認していない番号は登録しない
+type PhoneChangeService struct {
+	users   userRepository
+	store   phoneChangeStore
+	clock   clock
+	sms     sms.SMSSender
+	mailer  mail.Mailer
+	baseURL *url.URL
+}
+
+// PhoneChangeServiceを生成する
+// baseURL は確認リンクの遷移先で、トークンはクエリパラメータ token として付与される
+// sender が nil の場合は電話番号の登録や変更を無効にする。登録済みの電話番号は削除できる
+func NewPhoneChangeService(users userRepository, store phoneChangeStore, clock clock, sender sms.SMSSender, mailer mail.Mailer, baseURL string) (*PhoneChangeService, error) {
+	if mailer == nil {
+		return nil, errors.New("mailer is nil")
+	}
+	u, err := parseLinkBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &PhoneChangeService{
+		users:   users,
+		store:   store,
+		clock:   clock,
+		sms:     sender,
+		mailer:  mailer,
+		baseURL: u,
+	}, nil
+}
+
+// 電話番号の登録や変更を申請する
+// 変更後の番号にSMSで確認リンクを送り、乗っ取りに気づけるよう登録中のメールアドレスにも通知する
+func (s *PhoneChangeService) Request(ctx context.Context, userID, phone string) (*model.PendingPhoneChange, error) {
+	if s.sms == nil {
+		return nil, ErrSMSDisabled
+	}
+	phone, err := NormalizePhoneNumber(phone)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Phone != nil && *user.Phone == phone {
+		return nil, ErrPhoneUnchanged
+	}
+	if err := s.checkAvailable(ctx, userID, phone); err != nil {
+		return nil, err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	change := &model.PendingPhoneChange{
+		Phone:     phone,
+		ExpiresAt: s.clock.Now().Add(phoneChangeExpire).Truncate(time.Second),
+	}
+	if err := s.store.SavePhoneChange(ctx, userID, hashMagicLinkToken(token), change); err != nil {
+		return nil, err
+	}
+
+	// SMSは文字数の制約があるため、本文は短くする
+	err = s.sms.Send(ctx, sms.Message{
+		To:   phone,
+		Body: fmt.Sprintf("魚丼 電話番号の確認 (%d分間有効)\n%s", int(phoneChangeExpire.Minutes()), linkWithToken(s.baseURL, token)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "魚丼 電話番号の変更の申請",
+		Body: fmt.Sprintf(
+			"%s さん\n\n魚丼に登録する電話番号を %s に変更する申請を受け付けました。\n変更は新しい電話番号での確認後に反映されます。\n\n心当たりがない場合は、ログインして変更を取り消し、全ての端末からログアウトしてください。\n",
+			user.DisplayName, phone,
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// 確認待ちの電話番号の変更を返す
+// 確認待ちの変更がない場合は nil を返す
+func (s *PhoneChangeService) Pending(ctx context.Context, userID string) (*model.PendingPhoneChange, error) {
+	change, ok, err := s.store.GetPhoneChange(ctx, userID)
+	if err != nil || !ok || !s.clock.Now().Before(change.ExpiresAt) {
+		return nil, err
+	}
+	return change, nil
+}
+
+// 確認リンクのトークンを検証し、電話番号を変更したユーザーを返す
+func (s *PhoneChangeService) Confirm(ctx context.Context, token string) (*model.User, error) {
+	userID, change, ok, err := s.store.ConsumePhoneChange(ctx, hashMagicLinkToken(token))
+	if err != nil {
+		return nil, err
+	}
+	// 有効期限は保存先の失効に頼らず、サービスの時刻で判定する
+	if !ok || !s.clock.Now().Before(change.ExpiresAt) {
+		return nil, ErrInvalidPhoneChangeLink
+	}
+	phone := change.Phone
+	user, err := s.users.GetUserByID(ctx, userID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		// 申請後にユーザーが削除された
+		return nil, ErrInvalidPhoneChangeLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 申請から確認までの間に、他のユーザーが同じ番号を登録している場合がある
+	if err := s.checkAvailable(ctx, userID, phone); err != nil {
+		return nil, err
+	}
+	if err := s.users.UpdateUserPhone(ctx, userID, &phone); err != nil {
+		return nil, err
+	}
+
+	user.Phone = &phone
+	// 変更は既に反映しているため、通知に失敗してもエラーにはしない
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "魚丼 電話番号の変更の完了",
+		Body: fmt.Sprintf(
+			"%s さん\n\n魚丼に登録する電話番号を %s に変更しました。\n",
+			user.DisplayName, phone,
+		),
+	})
+	if err != nil {
+		log.Printf("failed to notify phone change: %v", err)
+	}
+	return user, nil
+}
+
+// 確認待ちの電話番号の変更を取り消す
+// 確認待ちの変更がない場合も成功とする
+func (s *PhoneChangeService) Cancel(ctx context.Context, userID string) error {
+	return s.store.DeletePhoneChange(ctx, userID)
+}
+
+// 登録している電話番号を削除する
+// 確認待ちの変更も取り消し、電話番号がない場合も成功とする
+func (s *PhoneChangeService) Remove(ctx context.Context, userID string) error {
+	if err := s.store.DeletePhoneChange(ctx, userID); err != nil {
+		return err
+	}
+	return s.users.UpdateUserPhone(ctx, userID, nil)
+}
+
+// 電話番号が他のユーザーに使われていないことを確認する
+func (s *PhoneChangeService) checkAvailable(ctx context.Context, userID, phone string) error {
+	other, err := s.users.GetUserByPhone(ctx, phone)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if other.ID != userID {
+		return domain.ErrPhoneTaken
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/domain"
+	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg"
+	"github.com/yDog-1/wodun/backend/pkg/mail"
+	"github.com/yDog-1/wodun/backend/pkg/sms"
+	"github.com/yDog-1/wodun/backend/service"
+)
+
+func newTestPhoneChangeService(t *testing.T) (*service.PhoneChangeService, *memoryUserRepository, *sms.MemorySender, *mail.MemoryMailer, *fakeClock) {
+	t.Helper()
+	users := newMemoryUserRepository(
+		&model.User{UniqueName: "ydog", DisplayName: "yDog", Email: "ydog@example.com"},
+		&model.User{UniqueName: "other", DisplayName: "other", Email: "other@example.com", Phone: pkg.PtrStr("+818011112222")},
+	)
+	sender := sms.NewMemorySender()
+	mailer := mail.NewMemoryMailer()
+	clock := newFakeClock()
+	s, err := service.NewPhoneChangeService(users, newMemoryPhoneChangeStore(), clock, sender, mailer, "https://wodun.example.com/phone/confirm")
+	require.NoError(t, err)
+	return s, users, sender, mailer, clock
+}
+
+func Test_SMSの確認リンクで電話番号を変更する(t *testing.T) {
+	ctx := context.Background()
+	s, users, sender, mailer, _ := newTestPhoneChangeService(t)
+
+	change, err := s.Request(ctx, "1", "090-1234-5678")
+	require.NoError(t, err)
+	assert.Equal(t, "+819012345678", change.Phone)
+
+	// 確認されるまでは電話番号を登録しないため、SMSでログインできない
+	_, err = users.GetUserByPhone(ctx, "+819012345678")
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	pending, err := s.Pending(ctx, "1")
+	require.NoError(t, err)
+	require.NotNil(t, pending)
+	assert.Equal(t, "+819012345678", pending.Phone)
+
+	// 変更後の番号に確認リンクを、登録中のメールアドレスに通知を送る
+	sent := sender.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "+819012345678", sent[0].To)
+	require.Len(t, mailer.Sent(), 1)
+	assert.Equal(t, "ydog@example.com", mailer.Sent()[0].To)
+	token := tokenFromBody(t, sent[0].Body)
+
+	user, err := s.Confirm(ctx, token)
+	require.NoError(t, err)
+	require.NotNil(t, user.Phone)
+	assert.Equal(t, "+819012345678", *user.Phone)
+	user, err = users.GetUserByPhone(ctx, "+819012345678")
+	require.NoError(t, err)
+	assert.Equal(t, "1", user.ID)
+
+	// 同じリンクは2回使えない
+	_, err = s.Confirm(ctx, token)
+	assert.ErrorIs(t, err, service.ErrInvalidPhoneChangeLink)
+	pending, err = s.Pending(ctx, "1")
+	require.NoError(t, err)
+	assert.Nil(t, pending)
+}
+
+func Test_電話番号の変更を申請できない番号(t *testing.T) {
+	ctx := context.Background()
+	s, _, sender, _, _ := newTestPhoneChangeService(t)
+
+	// 他のユーザーの番号は、表記が異なっても申請できない
+	_, err := s.Request(ctx, "1", "080-1111-2222")
+	assert.ErrorIs(t, err, domain.ErrPhoneTaken)
+
+	_, err = s.Request(ctx, "2", "+81 80 1111 2222")
+	assert.ErrorIs(t, err, service.ErrPhoneUnchanged)
+
+	_, err = s.Request(ctx, "1", "090-1234")
+	assert.ErrorIs(t, err, service.ErrInvalidPhoneNumber)
+
+	assert.Empty(t, sender.Sent())
+}
+
+func Test_期限切れのSMSの確認リンクは拒否する(t *testing.T) {
+	ctx := context.Background()
+	s, users, sender, _, clock := newTestPhoneChangeService(t)
+
+	change, err := s.Request(ctx, "1", "090-1234-5678")
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(15*time.Minute), change.ExpiresAt)
+
+	clock.Advance(15 * time.Minute)
+	pending, err := s.Pending(ctx, "1")
+	require.NoError(t, err)
+	assert.Nil(t, pending)
+	_, err = s.Confirm(ctx, tokenFromBody(t, sender.Sent()[0].Body))
+	assert.ErrorIs(t, err, service.ErrInvalidPhoneChangeLink)
+	_, err = users.GetUserByPhone(ctx, "+819012345678")
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func Test_電話番号を削除すると確認待ちの変更も取り消す(t *testing.T) {
+	ctx := context.Background()
+	s, users, sender, _, _ := newTestPhoneChangeService(t)
+
+	_, err := s.Request(ctx, "2", "090-1234-5678")
+	require.NoError(t, err)
+
+	err = s.Remove(ctx, "2")
+	require.NoError(t, err)
+	user, err := users.GetUserByID(ctx, "2")
+	require.NoError(t, err)
+	assert.Nil(t, user.Phone)
+	_, err = users.GetUserByPhone(ctx, "+818011112222")
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	pending, err := s.Pending(ctx, "2")
+	require.NoError(t, err)
+	assert.Nil(t, pending)
+	_, err = s.Confirm(ctx, tokenFromBody(t, sender.Sent()[0].Body))
+	assert.ErrorIs(t, err, service.ErrInvalidPhoneChangeLink)
+
+	// 電話番号がない場合も成功とする
+	err = s.Remove(ctx, "2")
+	assert.NoError(t, err)
+}
+
+func Test_SMSを送信できない場合は電話番号を変更できない(t *testing.T) {
+	ctx := context.Background()
+	users := newMemoryUserRepository(
+		&model.User{UniqueName: "ydog", DisplayName: "yDog", Email: "ydog@example.com", Phone: pkg.PtrStr("+819012345678")},
+	)
+	s, err := service.NewPhoneChangeService(users, newMemoryPhoneChangeStore(), newFakeClock(), nil, mail.NewMemoryMailer(), "https://wodun.example.com/phone/confirm")
+	require.NoError(t, err)
+
+	_, err = s.Request(ctx, "1", "080-1111-2222")
+	assert.ErrorIs(t, err, service.ErrSMSDisabled)
+
+	// 登録済みの電話番号は削除できる
+	require.NoError(t, s.Remove(ctx, "1"))
+	user, err := users.GetUserByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Nil(t, user.Phone)
+}
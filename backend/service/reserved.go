@@ -0,0 +1,56 @@
+package service
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/yDog-1/wodun/backend/pkg/confusable"
+)
+
+// 運営や機能と紛らわしいため、ユーザーが登録できない固有名
+var reservedUniqueNames = []string{
+	"admin", "administrator", "root", "system", "sysadmin",
+	"support", "help", "info", "contact", "security", "abuse",
+	"staff", "moderator", "mod", "official", "owner", "team",
+	"api", "www", "mail", "noreply", "no_reply", "postmaster", "webmaster",
+	"login", "logout", "signin", "signup", "register", "settings", "account",
+	"me", "user", "users", "anonymous", "null", "undefined", "everyone", "here",
+}
+
+// 固有名の一部に含まれていても登録できない語
+// サービス名を含む固有名は、公式のアカウントと誤認されやすい
+var reservedUniqueNameParts = []string{
+	"wodun",
+}
+
+var (
+	reservedSkeletons     = skeletons(reservedUniqueNames)
+	reservedPartSkeletons = skeletons(reservedUniqueNameParts)
+)
+
+func skeletons(words []string) []string {
+	res := make([]string, len(words))
+	for i, w := range words {
+		res[i] = confusable.Skeleton(w)
+	}
+	return res
+}
+
+// 予約された固有名か、予約された固有名と紛らわしいかを返す
+// skeleton は大文字の I を l にするため、"ADMIN" のように大文字で書いた予約語は小文字にしても比べる
+func reservedUniqueName(name string) bool {
+	return reservedSkeleton(confusable.Skeleton(name)) ||
+		reservedSkeleton(confusable.Skeleton(strings.ToLower(name)))
+}
+
+func reservedSkeleton(s string) bool {
+	if slices.Contains(reservedSkeletons, s) {
+		return true
+	}
+	for _, r := range reservedPartSkeletons {
+		if strings.Contains(s, r) {
+			return true
+		}
+	}
+	return false
+}
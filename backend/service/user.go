@@ -2,17 +2,44 @@ package service
 
 import (
 	"context"
+	"errors"
+	"strings"
 
+	"github.com/yDog-1/wodun/backend/domain"
 	"github.com/yDog-1/wodun/backend/graph/model"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/pagination"
 )
 
 type userRepository interface {
 	GetUser(ctx context.Context, uniqueName string) (*model.User, error)
+	GetUserByID(ctx context.Context, id string) (*model.User, error)
+	// IDの一覧に含まれるユーザーをまとめて取得する。存在しないIDは結果に含めない
+	GetUsersByIDs(ctx context.Context, ids []string) ([]*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	// 固有名と見た目の紛らわしい固有名のユーザーを取得する
+	GetUserByConfusableName(ctx context.Context, uniqueName string) (*model.User, error)
+	GetUserByPhone(ctx context.Context, phone string) (*model.User, error)
 	CreateUser(ctx context.Context, input *model.CreateUserInput) (string, error)
 	UpdateUser(ctx context.Context, id string, input *model.UpdateUserInput) error
+	// メールアドレスを確認済みのアドレスに変更する
+	UpdateUserEmail(ctx context.Context, id string, email string) error
+	// メールアドレスが email のままであれば確認済みにする
+	VerifyUserEmail(ctx context.Context, id string, email string) error
+	// 電話番号を変更する。phone が nil の場合は削除する
+	UpdateUserPhone(ctx context.Context, id string, phone *string) error
+	UpdateUserRole(ctx context.Context, id string, role auth.Role) error
+	RenameUser(ctx context.Context, actorID, id, uniqueName, reason string) error
+	ListUserAuditLogs(ctx context.Context, id string) ([]*model.UserAuditLog, error)
 	DeleteUser(ctx context.Context, uniqueName string) error
-	// ListUsers(ctx context.Context) ([]*model.User, error)
+	// ユーザーをIDの順に、after より後ろから limit 件まで取得する
+	ListUsers(ctx context.Context, after string, limit int) ([]*model.User, error)
 }
+
+// 監査ログに記録する操作の理由が空
+var ErrAuditReasonRequired = apperr.Validation(apperr.Field("reason", "reason is required"))
+
 type UserService struct {
 	repo userRepository
 }
@@ -25,20 +52,146 @@ func (s *UserService) GetUser(ctx context.Context, uniqueName string) (*model.Us
 	return s.repo.GetUser(ctx, uniqueName)
 }
 
+func (s *UserService) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	return s.repo.GetUserByID(ctx, id)
+}
+
+// IDの一覧に含まれるユーザーをまとめて返す
+// 存在しないIDは結果に含めず、結果の順序は ids と一致しない
+func (s *UserService) GetUsersByIDs(ctx context.Context, ids []string) ([]*model.User, error) {
+	return s.repo.GetUsersByIDs(ctx, ids)
+}
+
+// ユーザーを作成順に1ページ分返す
+func (s *UserService) ListUsers(ctx context.Context, page pagination.Page) (*model.UserConnection, error) {
+	users, err := s.repo.ListUsers(ctx, page.After, page.Limit())
+	if err != nil {
+		return nil, err
+	}
+	return pagination.NewConnection(users, page, func(u *model.User) string { return u.ID }), nil
+}
+
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return s.repo.GetUserByEmail(ctx, email)
+}
+
+// 所有を確認できたメールアドレスを確認済みにする
+// 確認の間にメールアドレスが変更されていた場合は何もしない
+func (s *UserService) VerifyEmail(ctx context.Context, id, email string) error {
+	return s.repo.VerifyUserEmail(ctx, id, email)
+}
+
+// ユーザーを作成する
+// 入力は正規化してから検証し、誤りのある全ての項目をまとめて返す
+// 予約された固有名や、他のユーザーと見た目の紛らわしい固有名では作成できない
 func (s *UserService) CreateUser(ctx context.Context, input *model.CreateUserInput) (string, error) {
-	return s.repo.CreateUser(ctx, input)
+	var v validator
+	normalized := &model.CreateUserInput{
+		UniqueName:  v.uniqueName("uniqueName", input.UniqueName),
+		DisplayName: v.displayName("displayName", input.DisplayName),
+		Email:       v.email("email", input.Email),
+	}
+	v.check(!reservedUniqueName(normalized.UniqueName), "uniqueName", "unique name is reserved")
+	if err := v.err(); err != nil {
+		return "", err
+	}
+	if err := s.checkConfusable(ctx, "", normalized.UniqueName); err != nil {
+		return "", err
+	}
+	return s.repo.CreateUser(ctx, normalized)
+}
+
+// 固有名が他のユーザーの固有名と見た目で区別できる場合に nil を返す
+// id のユーザー自身の固有名とは比べない
+func (s *UserService) checkConfusable(ctx context.Context, id, uniqueName string) error {
+	user, err := s.repo.GetUserByConfusableName(ctx, uniqueName)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.ID == id {
+		return nil
+	}
+	if strings.EqualFold(user.UniqueName, uniqueName) {
+		return domain.ErrUniqueNameTaken
+	}
+	return domain.ErrUniqueNameConfusable
 }
 
+// ユーザー情報を更新する
+// 固有名は管理者の RenameUser でのみ変更できる
 func (s *UserService) UpdateUser(ctx context.Context, id string, input *model.UpdateUserInput) error {
+	var v validator
+	var displayName *string
+	if input.DisplayName != nil {
+		n := v.displayName("displayName", *input.DisplayName)
+		displayName = &n
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
 	return s.repo.UpdateUser(ctx, id,
 		&model.UpdateUserInput{
-			ID:          id,
-			UniqueName:  input.UniqueName,
-			DisplayName: input.DisplayName,
-			Email:       input.Email,
+			DisplayName: displayName,
 		},
 	)
 }
+
+// ユーザーの権限を変更する
+// 存在しないユーザーの場合は domain.ErrUserNotFound を返す
+func (s *UserService) SetRole(ctx context.Context, id string, role auth.Role) error {
+	if !role.Valid() {
+		return auth.ErrInvalidRole
+	}
+	if _, err := s.repo.GetUserByID(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.UpdateUserRole(ctx, id, role)
+}
+
+// 管理者の操作としてユーザーの固有名を変更する
+// 変更は操作した管理者と理由とともに監査ログに記録する
+// 予約された固有名には変更できるが、他のユーザーと見た目の紛らわしい固有名には変更できない
+func (s *UserService) RenameUser(ctx context.Context, actorID, id, uniqueName, reason string) (*model.User, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrAuditReasonRequired
+	}
+	var v validator
+	uniqueName = v.uniqueName("uniqueName", uniqueName)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.UniqueName == uniqueName {
+		return user, nil
+	}
+	_, err = s.repo.GetUser(ctx, uniqueName)
+	if err == nil {
+		return nil, domain.ErrUniqueNameTaken
+	}
+	if !errors.Is(err, domain.ErrUserNotFound) {
+		return nil, err
+	}
+	if err := s.checkConfusable(ctx, id, uniqueName); err != nil {
+		return nil, err
+	}
+	if err := s.repo.RenameUser(ctx, actorID, id, uniqueName, reason); err != nil {
+		return nil, err
+	}
+	return s.repo.GetUserByID(ctx, id)
+}
+
+// ユーザーに対する管理者の操作の記録を、新しい順に返す
+func (s *UserService) AuditLogs(ctx context.Context, id string) ([]*model.UserAuditLog, error) {
+	return s.repo.ListUserAuditLogs(ctx, id)
+}
+
 func (s *UserService) DeleteUser(ctx context.Context, uniqueName string) error {
 	return s.repo.DeleteUser(ctx, uniqueName)
 }
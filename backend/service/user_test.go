@@ -2,13 +2,19 @@ package service_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yDog-1/wodun/backend/domain"
 	"github.com/yDog-1/wodun/backend/graph/model"
 	"github.com/yDog-1/wodun/backend/pkg"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+	"github.com/yDog-1/wodun/backend/pkg/auth"
+	"github.com/yDog-1/wodun/backend/pkg/pagination"
 	"github.com/yDog-1/wodun/backend/pkg/testing/container"
 	"github.com/yDog-1/wodun/backend/repository"
 	"github.com/yDog-1/wodun/backend/service"
@@ -38,7 +44,10 @@ func Test_ユーザーを作成する(t *testing.T) {
 
 	id, err := s.CreateUser(ctx, &input)
 	require.NoError(t, err)
-	assert.NotEqual(t, "", id)
+	// IDは連番ではなく UUIDv7 になる
+	publicID, err := uuid.Parse(id)
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Version(7), publicID.Version())
 
 	user, err := s.GetUser(ctx, "ydog")
 	assert.NoError(t, err)
@@ -76,15 +85,375 @@ func Test_ユーザーの情報を更新する(t *testing.T) {
 	require.NotEqual(t, "", id)
 
 	err = s.UpdateUser(ctx, id, &model.UpdateUserInput{
-		UniqueName: pkg.PtrStr("modified"),
-		Email:      pkg.PtrStr("modified.ydog@example.com"),
+		DisplayName: pkg.PtrStr("modified yDog"),
 	})
-	require.Nil(t, err)
+	require.NoError(t, err)
 
-	user, err := s.GetUser(ctx, "modified")
+	user, err := s.GetUser(ctx, "ydog")
 	assert.NoError(t, err)
-	assert.NotNil(t, user.ID)
-	assert.Equal(t, "modified", user.UniqueName)
-	assert.Equal(t, "yDog", user.DisplayName)
-	assert.Equal(t, "modified.ydog@example.com", user.Email)
+	assert.Equal(t, id, user.ID)
+	assert.Equal(t, "ydog", user.UniqueName)
+	assert.Equal(t, "modified yDog", user.DisplayName)
+	// メールアドレスは確認を経ずに変更できない
+	assert.Equal(t, "ydog@example.com", user.Email)
+}
+
+func Test_電話番号を変更して削除する(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	db, terminate := container.MysqlContainer(
+		t,
+		ctx,
+		container.MySQLcontainerInput(),
+	)
+	defer terminate()
+
+	repo := repository.NewUserRepository(db)
+	s := service.NewUserService(repo)
+	id, err := s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "ydog",
+		DisplayName: "yDog",
+		Email:       "ydog@example.com",
+	})
+	require.NoError(t, err)
+	otherID, err := s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "other",
+		DisplayName: "other",
+		Email:       "other@example.com",
+	})
+	require.NoError(t, err)
+
+	err = repo.UpdateUserPhone(ctx, id, pkg.PtrStr("+819012345678"))
+	require.NoError(t, err)
+	user, err := repo.GetUserByPhone(ctx, "+819012345678")
+	require.NoError(t, err)
+	assert.Equal(t, "ydog", user.UniqueName)
+
+	// 同じ番号は他のユーザーに登録できない
+	err = repo.UpdateUserPhone(ctx, otherID, pkg.PtrStr("+819012345678"))
+	assert.ErrorIs(t, err, domain.ErrPhoneTaken)
+
+	// 削除した番号ではユーザーを引けない
+	err = repo.UpdateUserPhone(ctx, id, nil)
+	require.NoError(t, err)
+	_, err = repo.GetUserByPhone(ctx, "+819012345678")
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	user, err = repo.GetUserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Nil(t, user.Phone)
+}
+
+func Test_ユーザーの権限を変更する(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	db, terminate := container.MysqlContainer(
+		t,
+		ctx,
+		container.MySQLcontainerInput(),
+	)
+	defer terminate()
+
+	s := service.NewUserService(repository.NewUserRepository(db))
+	id, err := s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "yamada",
+		DisplayName: "Moderator",
+		Email:       "moderator@example.com",
+	})
+	require.NoError(t, err)
+
+	// 作成直後は一般のユーザーになる
+	user, err := s.GetUserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleMember, user.Role)
+
+	require.NoError(t, s.SetRole(ctx, id, auth.RoleModerator))
+	user, err = s.GetUserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleModerator, user.Role)
+
+	// 存在しない権限やユーザーは指定できない
+	assert.ErrorIs(t, s.SetRole(ctx, id, auth.Role("owner")), auth.ErrInvalidRole)
+	assert.ErrorIs(t, s.SetRole(ctx, "999999", auth.RoleAdmin), domain.ErrUserNotFound)
+}
+
+func Test_管理者がユーザーの固有名を変更する(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	db, terminate := container.MysqlContainer(
+		t,
+		ctx,
+		container.MySQLcontainerInput(),
+	)
+	defer terminate()
+
+	s := service.NewUserService(repository.NewUserRepository(db))
+	adminID, err := s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "kanrinin",
+		DisplayName: "Admin",
+		Email:       "admin@example.com",
+	})
+	require.NoError(t, err)
+	id, err := s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "impersonator",
+		DisplayName: "Impersonator",
+		Email:       "impersonator@example.com",
+	})
+	require.NoError(t, err)
+
+	user, err := s.RenameUser(ctx, adminID, id, "renamed", "なりすましの申し立て")
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", user.UniqueName)
+
+	// 変更は監査ログに記録される
+	logs, err := s.AuditLogs(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.NotNil(t, logs[0].ActorID)
+	assert.Equal(t, adminID, *logs[0].ActorID)
+	assert.Equal(t, model.UserAuditActionRename, logs[0].Action)
+	assert.Equal(t, "impersonator", logs[0].OldValue)
+	assert.Equal(t, "renamed", logs[0].NewValue)
+	assert.Equal(t, "なりすましの申し立て", logs[0].Reason)
+
+	// 他のユーザーの固有名には変更できず、理由は省略できない
+	_, err = s.RenameUser(ctx, adminID, id, "kanrinin", "重複")
+	assert.ErrorIs(t, err, domain.ErrUniqueNameTaken)
+	_, err = s.RenameUser(ctx, adminID, id, "renamed2", " ")
+	assert.ErrorIs(t, err, service.ErrAuditReasonRequired)
+	logs, err = s.AuditLogs(ctx, id)
+	require.NoError(t, err)
+	assert.Len(t, logs, 1)
+
+	// 管理者は予約された固有名にも変更できる
+	user, err = s.RenameUser(ctx, adminID, id, "admin", "公式アカウントへの移行")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", user.UniqueName)
+
+	// 操作した管理者が削除されても記録は残り、操作した管理者は nil になる
+	err = s.DeleteUser(ctx, "kanrinin")
+	require.NoError(t, err)
+	logs, err = s.AuditLogs(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	for _, l := range logs {
+		assert.Nil(t, l.ActorID)
+	}
+}
+
+func Test_固有名やメールアドレスが重複するユーザーは作成できない(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	db, terminate := container.MysqlContainer(
+		t,
+		ctx,
+		container.MySQLcontainerInput(),
+	)
+	defer terminate()
+
+	s := service.NewUserService(repository.NewUserRepository(db))
+	_, err := s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "ydog",
+		DisplayName: "yDog",
+		Email:       "ydog@example.com",
+	})
+	require.NoError(t, err)
+
+	// メールアドレスが異なっていても、同じ固有名は使えない
+	_, err = s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "ydog",
+		DisplayName: "yDog",
+		Email:       "another@example.com",
+	})
+	assert.ErrorIs(t, err, domain.ErrUniqueNameTaken)
+
+	// メールアドレスは大文字小文字を区別しない
+	_, err = s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "another",
+		DisplayName: "another",
+		Email:       "YDOG@example.com",
+	})
+	assert.ErrorIs(t, err, domain.ErrEmailTaken)
+}
+
+func Test_入力を正規化してユーザーを作成する(t *testing.T) {
+	ctx := context.Background()
+	s := service.NewUserService(newMemoryUserRepository())
+
+	id, err := s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "ｙｄｏｇ＿１",
+		DisplayName: " 👨‍👩‍👧‍👦ﾜｰﾄﾞﾝ ",
+		Email:       "ｙｄｏｇ@example.com",
+	})
+	require.NoError(t, err)
+	user, err := s.GetUserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "ydog_1", user.UniqueName)
+	assert.Equal(t, "👨‍👩‍👧‍👦ワードン", user.DisplayName)
+	assert.Equal(t, "ydog@example.com", user.Email)
+}
+
+func Test_不正な入力の項目をまとめて返す(t *testing.T) {
+	ctx := context.Background()
+	s := service.NewUserService(newMemoryUserRepository())
+
+	_, err := s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  strings.Repeat("a", 31),
+		DisplayName: strings.Repeat("👨‍👩‍👧‍👦", 31),
+		Email:       "yDog <ydog@example.com>",
+	})
+	var e *apperr.Error
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, apperr.CodeValidation, e.Code)
+	assert.Equal(t, []apperr.FieldError{
+		apperr.Field("uniqueName", "must be at most 30 characters"),
+		apperr.Field("displayName", "must be at most 30 characters"),
+		apperr.Field("email", "invalid email address"),
+	}, e.Fields)
+}
+
+func Test_不正な固有名は拒否する(t *testing.T) {
+	ctx := context.Background()
+	s := service.NewUserService(newMemoryUserRepository())
+
+	tests := []struct {
+		name       string
+		uniqueName string
+		want       []string
+	}{
+		{"短すぎる", "ab", []string{"must be at least 3 characters"}},
+		{"長すぎる", strings.Repeat("a", 31), []string{"must be at most 30 characters"}},
+		{"絵文字", "😀😀😀", []string{"must contain only letters, digits and underscores"}},
+		{"記号", "y-dog", []string{"must contain only letters, digits and underscores"}},
+		{"空", " ", []string{"must be at least 3 characters"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.CreateUser(ctx, &model.CreateUserInput{
+				UniqueName:  tt.uniqueName,
+				DisplayName: "yDog",
+				Email:       "ydog@example.com",
+			})
+			var e *apperr.Error
+			require.ErrorAs(t, err, &e)
+			var got []string
+			for _, f := range e.Fields {
+				assert.Equal(t, "uniqueName", f.Path)
+				got = append(got, f.Message)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_表示名は見た目の文字数で制限する(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryUserRepository(&model.User{UniqueName: "ydog", DisplayName: "yDog", Email: "ydog@example.com"})
+	s := service.NewUserService(repo)
+
+	// 国旗の絵文字は2つのコードポイントからなるが、1文字として数える
+	err := s.UpdateUser(ctx, "1", &model.UpdateUserInput{DisplayName: pkg.PtrStr(strings.Repeat("🇯🇵", 30))})
+	require.NoError(t, err)
+
+	for _, name := range []string{"", strings.Repeat("あ", 31), "y\x00dog", "y" + strings.Repeat("́", 200)} {
+		err := s.UpdateUser(ctx, "1", &model.UpdateUserInput{DisplayName: pkg.PtrStr(name)})
+		assert.Equal(t, apperr.CodeValidation, apperr.CodeOf(err), name)
+	}
+}
+
+func Test_予約された固有名では作成できない(t *testing.T) {
+	ctx := context.Background()
+	s := service.NewUserService(newMemoryUserRepository())
+
+	for _, name := range []string{"admin", "ADMIN", "adrnin", "ｓｕｐｐｏｒｔ", "LOGIN", "wodun", "wodun_official", "W0DUN_jp", "WODUN_OFFICIAL"} {
+		_, err := s.CreateUser(ctx, &model.CreateUserInput{
+			UniqueName:  name,
+			DisplayName: "yDog",
+			Email:       "ydog@example.com",
+		})
+		var e *apperr.Error
+		require.ErrorAs(t, err, &e, name)
+		assert.Equal(t, []apperr.FieldError{apperr.Field("uniqueName", "unique name is reserved")}, e.Fields, name)
+	}
+
+	// 予約語を一部に含むだけなら作成できる
+	_, err := s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "badminton",
+		DisplayName: "yDog",
+		Email:       "ydog@example.com",
+	})
+	assert.NoError(t, err)
+}
+
+func Test_既存のユーザーと紛らわしい固有名では作成できない(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryUserRepository(
+		&model.User{UniqueName: "ydog", DisplayName: "yDog", Email: "ydog@example.com"},
+		&model.User{UniqueName: "alex", DisplayName: "Alex", Email: "alex@example.com"},
+	)
+	s := service.NewUserService(repo)
+
+	tests := []struct {
+		name       string
+		uniqueName string
+		want       error
+	}{
+		{"数字の 0", "yd0g", domain.ErrUniqueNameConfusable},
+		{"大文字の I と l", "AIex", domain.ErrUniqueNameConfusable},
+		{"cl と d", "yclog", domain.ErrUniqueNameConfusable},
+		{"大文字", "YDOG", domain.ErrUniqueNameTaken},
+		{"全角英字", "ｙｄｏｇ", domain.ErrUniqueNameTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.CreateUser(ctx, &model.CreateUserInput{
+				UniqueName:  tt.uniqueName,
+				DisplayName: "impersonator",
+				Email:       "impersonator@example.com",
+			})
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	// 管理者も、他のユーザーと紛らわしい固有名には変更できない
+	id, err := s.CreateUser(ctx, &model.CreateUserInput{
+		UniqueName:  "yamada",
+		DisplayName: "yamada",
+		Email:       "yamada@example.com",
+	})
+	require.NoError(t, err)
+	_, err = s.RenameUser(ctx, "1", id, "yd0g", "なりすましの申し立て")
+	assert.ErrorIs(t, err, domain.ErrUniqueNameConfusable)
+	assert.Empty(t, repo.logs)
+}
+
+func Test_ユーザーを作成順にページ分割して返す(t *testing.T) {
+	ctx := context.Background()
+	s := service.NewUserService(newMemoryUserRepository(
+		&model.User{UniqueName: "user_a", DisplayName: "a", Email: "a@example.com"},
+		&model.User{UniqueName: "user_b", DisplayName: "b", Email: "b@example.com"},
+		&model.User{UniqueName: "user_c", DisplayName: "c", Email: "c@example.com"},
+	))
+
+	conn, err := s.ListUsers(ctx, pagination.Page{First: 2})
+	require.NoError(t, err)
+	require.Len(t, conn.Edges, 2)
+	assert.Equal(t, "user_a", conn.Edges[0].Node.UniqueName)
+	assert.Equal(t, "user_b", conn.Edges[1].Node.UniqueName)
+	assert.True(t, conn.PageInfo.HasNextPage)
+
+	after, err := pagination.DecodeCursor(*conn.PageInfo.EndCursor)
+	require.NoError(t, err)
+	conn, err = s.ListUsers(ctx, pagination.Page{First: 2, After: after})
+	require.NoError(t, err)
+	require.Len(t, conn.Edges, 1)
+	assert.Equal(t, "user_c", conn.Edges[0].Node.UniqueName)
+	assert.False(t, conn.PageInfo.HasNextPage)
 }
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	netmail "net/mail"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"github.com/yDog-1/wodun/backend/pkg/apperr"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	uniqueNameMinLength = 3
+	uniqueNameMaxLength = 30
+	// 表示名の長さは見た目の文字数 (書記素クラスタ) で数える
+	displayNameMaxLength = 30
+	// 結合文字を重ねた表示名が users.display_name に収まるよう、コードポイントの数も制限する
+	displayNameMaxRunes = 120
+	// users.email の長さ
+	emailMaxLength = 255
+)
+
+// 固有名に使える文字
+var uniqueNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// 入力の誤りを項目ごとに集める
+// 全ての項目を検証してから err でまとめて返すため、クライアントは誤りを一度に表示できる
+type validator struct {
+	fields []apperr.FieldError
+}
+
+// ok でない場合に項目の誤りを記録する
+func (v *validator) check(ok bool, path, message string) {
+	if !ok {
+		v.fields = append(v.fields, apperr.Field(path, message))
+	}
+}
+
+// 記録した誤りをまとめたエラーを返す。誤りがない場合は nil を返す
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return apperr.Validation(v.fields...)
+}
+
+// 全角英数字などを NFKC で正規化し、前後の空白を取り除く
+func normalizeText(s string) string {
+	return strings.TrimSpace(norm.NFKC.String(s))
+}
+
+// 固有名を正規化して検証する
+func (v *validator) uniqueName(path, name string) string {
+	name = normalizeText(name)
+	n := utf8.RuneCountInString(name)
+	v.check(n >= uniqueNameMinLength, path, fmt.Sprintf("must be at least %d characters", uniqueNameMinLength))
+	v.check(n <= uniqueNameMaxLength, path, fmt.Sprintf("must be at most %d characters", uniqueNameMaxLength))
+	v.check(name == "" || uniqueNamePattern.MatchString(name), path, "must contain only letters, digits and underscores")
+	return name
+}
+
+// 表示名を正規化して検証する
+func (v *validator) displayName(path, name string) string {
+	name = normalizeText(name)
+	v.check(name != "", path, "is required")
+	v.check(uniseg.GraphemeClusterCount(name) <= displayNameMaxLength &&
+		utf8.RuneCountInString(name) <= displayNameMaxRunes,
+		path, fmt.Sprintf("must be at most %d characters", displayNameMaxLength))
+	v.check(!strings.ContainsFunc(name, unicode.IsControl), path, "must not contain control characters")
+	return name
+}
+
+// メールアドレスを正規化して検証する
+// 表示名付きの形式や、ヘッダーに改行を差し込む入力は受け付けない
+func (v *validator) email(path, email string) string {
+	email = normalizeText(email)
+	addr, err := netmail.ParseAddress(email)
+	v.check(err == nil && addr.Address == email, path, "invalid email address")
+	v.check(len(email) <= emailMaxLength, path, fmt.Sprintf("must be at most %d bytes", emailMaxLength))
+	return email
+}
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN phone varchar(16) NULL AFTER email;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE users ADD UNIQUE INDEX users_phone_key (phone);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP INDEX users_phone_key;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN phone;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_identities (
+	id serial PRIMARY KEY,
+	user_id bigint unsigned NOT NULL,
+	provider varchar(32) NOT NULL,
+	subject varchar(255) NOT NULL,
+	email varchar(255) NOT NULL,
+	created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE INDEX user_identities_provider_subject_key (provider, subject),
+	UNIQUE INDEX user_identities_user_provider_key (user_id, provider),
+	CONSTRAINT user_identities_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_identities;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_audit_logs (
+	id serial PRIMARY KEY,
+	-- 操作した管理者
+	actor_id bigint unsigned NOT NULL,
+	-- 操作の対象のユーザー。ユーザーが削除されても記録は残す
+	user_id bigint unsigned NOT NULL,
+	action varchar(32) NOT NULL,
+	old_value varchar(255) NOT NULL,
+	new_value varchar(255) NOT NULL,
+	reason varchar(1024) NOT NULL,
+	created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	INDEX user_audit_logs_user_id_idx (user_id, created_at)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_audit_logs;
+-- +goose StatementEnd
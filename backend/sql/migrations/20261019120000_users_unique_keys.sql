@@ -0,0 +1,30 @@
+-- +goose Up
+-- 固有名とメールアドレスをそれぞれ一意にする
+-- 既に重複している行がある場合は失敗するため、先に重複を解消しておく
+-- +goose StatementBegin
+ALTER TABLE users DROP INDEX unique_name;
+-- +goose StatementEnd
+-- メールアドレスは大文字小文字を区別せずに比較する。アクセント記号は区別する
+-- +goose StatementBegin
+ALTER TABLE users MODIFY COLUMN email varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_as_ci NOT NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE users ADD UNIQUE INDEX users_unique_name_key (unique_name);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE users ADD UNIQUE INDEX users_email_key (email);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP INDEX users_email_key;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE users DROP INDEX users_unique_name_key;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE users MODIFY COLUMN email varchar(255) NOT NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE users ADD UNIQUE INDEX unique_name (unique_name, email);
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- 表示名の長さは書記素クラスタで30文字までとし、絵文字などの複数のコードポイントからなる文字が収まるよう広げる
+-- +goose StatementBegin
+ALTER TABLE users MODIFY COLUMN display_name varchar(120) NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users MODIFY COLUMN display_name varchar(30) NOT NULL;
+-- +goose StatementEnd
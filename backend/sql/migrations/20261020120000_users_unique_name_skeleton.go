@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+	"github.com/yDog-1/wodun/backend/pkg/confusable"
+)
+
+func init() {
+	// MySQL の DDL はトランザクションに含められないため、トランザクションの外で実行する
+	goose.AddMigrationNoTxContext(upUsersUniqueNameSkeleton, downUsersUniqueNameSkeleton)
+}
+
+// 見た目の紛らわしい固有名を登録できないよう、固有名の skeleton (pkg/confusable) を保持する
+// 既存の行の skeleton は、アプリケーションと同じ値になるよう confusable.Skeleton で計算する
+// 既に skeleton が重複している行がある場合は失敗するため、先に重複を解消しておく
+func upUsersUniqueNameSkeleton(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `ALTER TABLE users ADD COLUMN unique_name_skeleton varchar(120) NOT NULL DEFAULT ''`)
+	if err != nil {
+		return err
+	}
+	if err := backfillUniqueNameSkeleton(ctx, db); err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `ALTER TABLE users ALTER COLUMN unique_name_skeleton DROP DEFAULT`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `ALTER TABLE users ADD UNIQUE INDEX users_unique_name_skeleton_key (unique_name_skeleton)`)
+	return err
+}
+
+func backfillUniqueNameSkeleton(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT id, unique_name FROM users`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	skeletons := map[uint64]string{}
+	for rows.Next() {
+		var id uint64
+		var uniqueName string
+		if err := rows.Scan(&id, &uniqueName); err != nil {
+			return err
+		}
+		skeletons[id] = confusable.Skeleton(uniqueName)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `UPDATE users SET unique_name_skeleton = ? WHERE id = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for id, skeleton := range skeletons {
+		if _, err := stmt.ExecContext(ctx, skeleton, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func downUsersUniqueNameSkeleton(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `ALTER TABLE users DROP INDEX users_unique_name_skeleton_key`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `ALTER TABLE users DROP COLUMN unique_name_skeleton`)
+	return err
+}
@@ -0,0 +1,31 @@
+-- +goose Up
+-- 連番の id はユーザー数の推測や列挙に使えるため、外部には UUIDv7 の public_id を公開する
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN public_id char(36) CHARACTER SET ascii COLLATE ascii_bin NULL AFTER id;
+-- +goose StatementEnd
+-- 既存の行には、users を作成した 2025-01-13 を起点に id の順に並ぶ時刻で UUIDv7 を割り当てる
+-- 新しく作成するユーザーの public_id より必ず前に並ぶ
+-- +goose StatementBegin
+UPDATE users SET public_id = LOWER(CONCAT(
+	SUBSTR(LPAD(HEX(1736726400000 + id), 12, '0'), 1, 8), '-',
+	SUBSTR(LPAD(HEX(1736726400000 + id), 12, '0'), 9, 4), '-',
+	'7', SUBSTR(HEX(RANDOM_BYTES(2)), 1, 3), '-',
+	HEX(8 + FLOOR(RAND() * 4)), SUBSTR(HEX(RANDOM_BYTES(2)), 1, 3), '-',
+	HEX(RANDOM_BYTES(6))
+))
+WHERE public_id IS NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE users MODIFY COLUMN public_id char(36) CHARACTER SET ascii COLLATE ascii_bin NOT NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE users ADD UNIQUE INDEX users_public_id_key (public_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP INDEX users_public_id_key;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN public_id;
+-- +goose StatementEnd
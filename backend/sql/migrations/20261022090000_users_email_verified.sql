@@ -0,0 +1,11 @@
+-- +goose Up
+-- メールアドレスの所有を確認したかどうか
+-- 既存のユーザーは確認していないため、外部アカウントを自動で紐づけない
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN email_verified boolean NOT NULL DEFAULT FALSE AFTER email;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN email_verified;
+-- +goose StatementEnd
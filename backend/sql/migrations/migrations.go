@@ -0,0 +1,3 @@
+// Go で書いた goose のマイグレーション
+// SQL だけでは書けない変更に使う。登録されるよう、マイグレーションを実行するプログラムはこのパッケージを import する
+package migrations
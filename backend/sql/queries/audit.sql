@@ -0,0 +1,22 @@
+-- name: CreateUserAuditLog :exec
+INSERT INTO user_audit_logs (
+	actor_id, user_id, action, old_value, new_value, reason
+) VALUES (
+	?, ?, ?, ?, ?, ?
+);
+
+-- name: ListUserAuditLogs :many
+SELECT
+	user_audit_logs.id,
+	actors.public_id AS actor_id,
+	users.public_id AS user_id,
+	user_audit_logs.action,
+	user_audit_logs.old_value,
+	user_audit_logs.new_value,
+	user_audit_logs.reason,
+	user_audit_logs.created_at
+FROM user_audit_logs
+JOIN users ON users.id = user_audit_logs.user_id
+LEFT JOIN users AS actors ON actors.id = user_audit_logs.actor_id
+WHERE users.public_id = ?
+ORDER BY user_audit_logs.id DESC;
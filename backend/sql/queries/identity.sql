@@ -0,0 +1,13 @@
+-- name: GetUserIDByIdentity :one
+SELECT users.public_id
+FROM user_identities
+JOIN users ON users.id = user_identities.user_id
+WHERE user_identities.provider = ? AND user_identities.subject = ?;
+
+-- name: CreateUserIdentity :execrows
+INSERT INTO user_identities (
+	user_id, provider, subject, email
+)
+SELECT id, sqlc.arg('provider'), sqlc.arg('subject'), sqlc.arg('email')
+FROM users
+WHERE public_id = sqlc.arg('public_id');
@@ -1,26 +1,108 @@
 -- name: ListUsers :many
 SELECT
 	id,
+	public_id,
 	unique_name,
 	display_name,
-	email
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
 FROM users
-ORDER BY id;
+WHERE public_id > sqlc.arg('after')
+ORDER BY public_id
+LIMIT ?;
 
 -- name: GetUser :one
 SELECT
 	id,
+	public_id,
 	unique_name,
 	display_name,
-	email
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
 FROM users
 WHERE unique_name = ?;
 
+-- name: GetUserByPublicID :one
+SELECT
+	id,
+	public_id,
+	unique_name,
+	display_name,
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
+FROM users
+WHERE public_id = ?;
+
+-- name: GetUsersByPublicIDs :many
+SELECT
+	id,
+	public_id,
+	unique_name,
+	display_name,
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
+FROM users
+WHERE public_id IN (sqlc.slice('public_ids'));
+
+-- name: GetUserByEmail :one
+SELECT
+	id,
+	public_id,
+	unique_name,
+	display_name,
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
+FROM users
+WHERE email = ?;
+
+-- name: GetUserByUniqueNameSkeleton :one
+SELECT
+	id,
+	public_id,
+	unique_name,
+	display_name,
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
+FROM users
+WHERE unique_name_skeleton = ?;
+
+-- name: GetUserByPhone :one
+SELECT
+	id,
+	public_id,
+	unique_name,
+	display_name,
+	email,
+	email_verified,
+	phone,
+	role,
+	unique_name_skeleton
+FROM users
+WHERE phone = ?;
+
 -- name: CreateUser :exec
 INSERT INTO users (
-	unique_name, display_name, email
+	public_id, unique_name, unique_name_skeleton, display_name, email
 ) VALUES (
-	?, ?, ?
+	?, ?, ?, ?, ?
 );
 
 -- name: DeleteUser :exec
@@ -29,8 +111,32 @@ WHERE unique_name = ?;
 
 -- name: UpdateUser :exec
 UPDATE users
+SET display_name = COALESCE(sqlc.narg('display_name'), display_name)
+WHERE public_id = sqlc.arg('public_id');
+
+-- name: UpdateUserRole :exec
+UPDATE users
+SET role = sqlc.arg('role')
+WHERE public_id = sqlc.arg('public_id');
+
+-- name: UpdateUserEmail :exec
+UPDATE users
+SET email = sqlc.arg('email'), email_verified = TRUE
+WHERE public_id = sqlc.arg('public_id');
+
+-- name: VerifyUserEmail :exec
+UPDATE users
+SET email_verified = TRUE
+WHERE public_id = sqlc.arg('public_id') AND email = sqlc.arg('email');
+
+-- name: UpdateUserPhone :exec
+UPDATE users
+SET phone = sqlc.narg('phone')
+WHERE public_id = sqlc.arg('public_id');
+
+-- name: RenameUser :exec
+UPDATE users
 SET
-	unique_name = COALESCE(sqlc.narg('unique_name'), unique_name),
-	display_name = COALESCE(sqlc.narg('display_name'), display_name),
-	email = COALESCE(sqlc.narg('email'), email)
-WHERE unique_name = sqlc.arg('current_unique_name');
+	unique_name = sqlc.arg('unique_name'),
+	unique_name_skeleton = sqlc.arg('unique_name_skeleton')
+WHERE id = sqlc.arg('id');